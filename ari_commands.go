@@ -1,37 +1,85 @@
 package ari
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
-func buildJSON(params map[string]string) string {
-	mapsize := len(params)
-	var counter int = 1
-	body := bytes.NewBufferString("{")
+// commandParams encodes the parameters of a command, given as a map or one of
+// the request structs. The parameters of GET and DELETE commands are appended
+// to path as a query string and the body is left empty; those of other
+// commands are encoded as a JSON body.
+func commandParams(method string, path string, params interface{}) (string, string) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return path, ""
+	}
+	if method != "GET" && method != "DELETE" {
+		return path, string(encoded)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(encoded, &fields)
+	query := url.Values{}
+	for key, value := range fields {
+		switch v := value.(type) {
+		case string:
+			query.Set(key, v)
+		case float64:
+			query.Set(key, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			query.Set(key, strconv.FormatBool(v))
+		default:
+			b, _ := json.Marshal(v)
+			query.Set(key, string(b))
+		}
+	}
+	if len(query) == 0 {
+		return path, ""
+	}
+	return strings.Join([]string{path, query.Encode()}, "?"), ""
+}
+
+// typedParams converts the parameters that ARI expects as numbers, booleans or
+// objects from the strings they are given as in the options of a command.
+// Variables are given as a JSON object, e.g. {"CALLERID(name)": "Alice"}.
+func typedParams(params map[string]interface{}) error {
 	for key, value := range params {
-		var s string
-		if counter < mapsize {
-			s = fmt.Sprintf("\"%s\":\"%s\",", key, value)
-		} else {
-			s = fmt.Sprintf("\"%s\":\"%s\"", key, value)
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var err error
+		switch key {
+		case "priority", "timeout", "offsetms", "skipms", "maxDurationSeconds", "maxSilenceSeconds",
+			"before", "between", "duration", "after":
+			params[key], err = strconv.Atoi(s)
+		case "beep":
+			params[key], err = strconv.ParseBool(s)
+		case "variables":
+			var variables map[string]string
+			err = json.Unmarshal([]byte(s), &variables)
+			params[key] = variables
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s: %s", key, s)
 		}
-		body.WriteString(s)
-		counter++
 	}
-	body.WriteString("}")
-	return body.String()
+	return nil
 }
 
 func (a *AppInstance) ApplicationsList() (*[]Application, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/applications")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []Application
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -39,16 +87,16 @@ func (a *AppInstance) ApplicationsList() (*[]Application, error) {
 
 func (a *AppInstance) ApplicationsGet(ApplicationName string) (*Application, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/applications/%s", ApplicationName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Application does not exist.")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Application does not exist.",
+	})
 	var r Application
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -56,21 +104,19 @@ func (a *AppInstance) ApplicationsGet(ApplicationName string) (*Application, err
 
 func (a *AppInstance) ApplicationsSubscribe(ApplicationName string, EventSource string) (*Application, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["eventSource"] = EventSource
 	url := fmt.Sprintf("/applications/%s/subscription", ApplicationName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Missing parameter.")
-	case 404:
-		err = errors.New("Application does not exist.")
-	case 422:
-		err = errors.New("Event source does not exist.")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Missing parameter.",
+		404: "Application does not exist.",
+		422: "Event source does not exist.",
+	})
 	var r Application
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -78,23 +124,20 @@ func (a *AppInstance) ApplicationsSubscribe(ApplicationName string, EventSource
 
 func (a *AppInstance) ApplicationsUnsubscribe(ApplicationName string, EventSource string) (*Application, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["eventSource"] = EventSource
 	url := fmt.Sprintf("/applications/%s/subscription", ApplicationName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Missing parameter; event source scheme not recognized.")
-	case 404:
-		err = errors.New("Application does not exist.")
-	case 409:
-		err = errors.New("Application not subscribed to event source.")
-	case 422:
-		err = errors.New("Event source does not exist.")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		400: "Missing parameter; event source scheme not recognized.",
+		404: "Application does not exist.",
+		409: "Application not subscribed to event source.",
+		422: "Event source does not exist.",
+	})
 	var r Application
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -102,7 +145,7 @@ func (a *AppInstance) ApplicationsUnsubscribe(ApplicationName string, EventSourc
 
 func (a *AppInstance) AsteriskGetInfo(options ...string) (*AsteriskInfo, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/asterisk/info")
 	for index, value := range options {
 		switch index {
@@ -112,9 +155,30 @@ func (a *AppInstance) AsteriskGetInfo(options ...string) (*AsteriskInfo, error)
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
+	var r AsteriskInfo
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// AsteriskGetInfoWith retrieves information about Asterisk as described by req.
+func (a *AppInstance) AsteriskGetInfoWith(req AsteriskInfoRequest) (*AsteriskInfo, error) {
+	var err error
+	url := fmt.Sprintf("/asterisk/info")
+	url, body := commandParams("GET", url, req)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r AsteriskInfo
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -122,17 +186,17 @@ func (a *AppInstance) AsteriskGetInfo(options ...string) (*AsteriskInfo, error)
 
 func (a *AppInstance) AsteriskGetGlobalVar(Var string) (*Variable, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["variable"] = Var
 	url := fmt.Sprintf("/asterisk/variable")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Missing variable parameter.")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		400: "Missing variable parameter.",
+	})
 	var r Variable
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -140,7 +204,7 @@ func (a *AppInstance) AsteriskGetGlobalVar(Var string) (*Variable, error) {
 
 func (a *AppInstance) AsteriskSetGlobalVar(Var string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["variable"] = Var
 	url := fmt.Sprintf("/asterisk/variable")
 	for index, value := range options {
@@ -151,24 +215,45 @@ func (a *AppInstance) AsteriskSetGlobalVar(Var string, options ...string) error
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Missing variable parameter.")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Missing variable parameter.",
+	})
+	return err
+}
+
+// AsteriskSetGlobalVarWith sets the value of a global variable as described by req.
+func (a *AppInstance) AsteriskSetGlobalVarWith(req VariableRequest) error {
+	var err error
+	url := fmt.Sprintf("/asterisk/variable")
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Missing variable parameter.",
+	})
 	return err
 }
 
 func (a *AppInstance) BridgesList() (*[]Bridge, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []Bridge
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -176,7 +261,7 @@ func (a *AppInstance) BridgesList() (*[]Bridge, error) {
 
 func (a *AppInstance) BridgesCreate(options ...string) (*Bridge, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges")
 	for index, value := range options {
 		switch index {
@@ -194,9 +279,30 @@ func (a *AppInstance) BridgesCreate(options ...string) (*Bridge, error) {
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, nil)
+	var r Bridge
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// BridgesCreateWith creates a bridge as described by req.
+func (a *AppInstance) BridgesCreateWith(req BridgeRequest) (*Bridge, error) {
+	var err error
+	url := fmt.Sprintf("/bridges")
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, nil)
 	var r Bridge
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -204,7 +310,7 @@ func (a *AppInstance) BridgesCreate(options ...string) (*Bridge, error) {
 
 func (a *AppInstance) BridgesCreate_Or_Update_With_ID(BridgeID string, options ...string) (*Bridge, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges/%s", BridgeID)
 	for index, value := range options {
 		switch index {
@@ -218,9 +324,15 @@ func (a *AppInstance) BridgesCreate_Or_Update_With_ID(BridgeID string, options .
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, nil)
 	var r Bridge
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -228,16 +340,16 @@ func (a *AppInstance) BridgesCreate_Or_Update_With_ID(BridgeID string, options .
 
 func (a *AppInstance) BridgesGet(BridgeID string) (*Bridge, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges/%s", BridgeID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Bridge not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Bridge not found",
+	})
 	var r Bridge
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -245,22 +357,22 @@ func (a *AppInstance) BridgesGet(BridgeID string) (*Bridge, error) {
 
 func (a *AppInstance) BridgesDestroy(BridgeID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges/%s", BridgeID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Bridge not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Bridge not found",
+	})
 	return err
 }
 
 func (a *AppInstance) BridgesAddChannel(BridgeID string, Channel string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["channel"] = Channel
 	url := fmt.Sprintf("/bridges/%s/addChannel", BridgeID)
 	for index, value := range options {
@@ -271,48 +383,63 @@ func (a *AppInstance) BridgesAddChannel(BridgeID string, Channel string, options
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Channel not found")
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge not in Stasis application; Channel currently recording")
-	case 422:
-		err = errors.New("Channel not in Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Channel not found",
+		404: "Bridge not found",
+		409: "Bridge not in Stasis application; Channel currently recording",
+		422: "Channel not in Stasis application",
+	})
+	return err
+}
+
+// BridgesAddChannelWith adds channels to a bridge as described by req.
+func (a *AppInstance) BridgesAddChannelWith(BridgeID string, req AddChannelRequest) error {
+	var err error
+	url := fmt.Sprintf("/bridges/%s/addChannel", BridgeID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Channel not found",
+		404: "Bridge not found",
+		409: "Bridge not in Stasis application; Channel currently recording",
+		422: "Channel not in Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) BridgesRemoveChannel(BridgeID string, Channel string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["channel"] = Channel
 	url := fmt.Sprintf("/bridges/%s/removeChannel", BridgeID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Channel not found")
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge not in Stasis application")
-	case 422:
-		err = errors.New("Channel not in this bridge")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Channel not found",
+		404: "Bridge not found",
+		409: "Bridge not in Stasis application",
+		422: "Channel not in this bridge",
+	})
 	return err
 }
 
 func (a *AppInstance) BridgesStartMoh(BridgeID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges/%s/moh", BridgeID)
 	for index, value := range options {
 		switch index {
@@ -322,39 +449,56 @@ func (a *AppInstance) BridgesStartMoh(BridgeID string, options ...string) error
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge not in Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Bridge not found",
+		409: "Bridge not in Stasis application",
+	})
+	return err
+}
+
+// BridgesStartMohWith plays music on hold to a bridge as described by req.
+func (a *AppInstance) BridgesStartMohWith(BridgeID string, req MohRequest) error {
+	var err error
+	url := fmt.Sprintf("/bridges/%s/moh", BridgeID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Bridge not found",
+		409: "Bridge not in Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) BridgesStopMoh(BridgeID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/bridges/%s/moh", BridgeID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge not in Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Bridge not found",
+		409: "Bridge not in Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) BridgesPlay(BridgeID string, Media string, options ...string) (*Playback, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["media"] = Media
 	url := fmt.Sprintf("/bridges/%s/play", BridgeID)
 	for index, value := range options {
@@ -377,16 +521,36 @@ func (a *AppInstance) BridgesPlay(BridgeID string, Media string, options ...stri
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Bridge not found",
+		409: "Bridge not in a Stasis application",
+	})
+	var r Playback
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// BridgesPlayWith starts playback of media on a bridge as described by req.
+func (a *AppInstance) BridgesPlayWith(BridgeID string, req PlayRequest) (*Playback, error) {
+	var err error
+	url := fmt.Sprintf("/bridges/%s/play", BridgeID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Bridge not found",
+		409: "Bridge not in a Stasis application",
+	})
 	var r Playback
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -394,7 +558,7 @@ func (a *AppInstance) BridgesPlay(BridgeID string, Media string, options ...stri
 
 func (a *AppInstance) BridgesPlayWithID(BridgeID string, PlaybackID string, Media string, options ...string) (*Playback, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["media"] = Media
 	url := fmt.Sprintf("/bridges/%s/play/%s", BridgeID, PlaybackID)
 	for index, value := range options {
@@ -413,16 +577,18 @@ func (a *AppInstance) BridgesPlayWithID(BridgeID string, PlaybackID string, Medi
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Bridge not found",
+		409: "Bridge not in a Stasis application",
+	})
 	var r Playback
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -430,7 +596,7 @@ func (a *AppInstance) BridgesPlayWithID(BridgeID string, PlaybackID string, Medi
 
 func (a *AppInstance) BridgesRecord(BridgeID string, Name string, Format string, options ...string) (*LiveRecording, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["name"] = Name
 	paramMap["format"] = Format
 	url := fmt.Sprintf("/bridges/%s/record", BridgeID)
@@ -458,20 +624,40 @@ func (a *AppInstance) BridgesRecord(BridgeID string, Name string, Format string,
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters")
-	case 404:
-		err = errors.New("Bridge not found")
-	case 409:
-		err = errors.New("Bridge is not in a Stasis application; A recording with the same name already exists on the system and can not be overwritten because it is in progress or ifExists=fail")
-	case 422:
-		err = errors.New("The format specified is unknown on this system")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Bridge not found",
+		409: "Bridge is not in a Stasis application; A recording with the same name already exists on the system and can not be overwritten because it is in progress or ifExists=fail",
+		422: "The format specified is unknown on this system",
+	})
+	var r LiveRecording
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// BridgesRecordWith starts a recording of a bridge as described by req.
+func (a *AppInstance) BridgesRecordWith(BridgeID string, req RecordRequest) (*LiveRecording, error) {
+	var err error
+	url := fmt.Sprintf("/bridges/%s/record", BridgeID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Bridge not found",
+		409: "Bridge is not in a Stasis application; A recording with the same name already exists on the system and can not be overwritten because it is in progress or ifExists=fail",
+		422: "The format specified is unknown on this system",
+	})
 	var r LiveRecording
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -479,11 +665,14 @@ func (a *AppInstance) BridgesRecord(BridgeID string, Name string, Format string,
 
 func (a *AppInstance) ChannelsList() (*[]Channel, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []Channel
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -491,7 +680,7 @@ func (a *AppInstance) ChannelsList() (*[]Channel, error) {
 
 func (a *AppInstance) ChannelsOriginate(Endpoint string, options ...string) (*Channel, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["endpoint"] = Endpoint
 	url := fmt.Sprintf("/channels")
 	for index, value := range options {
@@ -538,14 +727,34 @@ func (a *AppInstance) ChannelsOriginate(Endpoint string, options ...string) (*Ch
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters for originating a channel.")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters for originating a channel.",
+	})
+	var r Channel
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// ChannelsOriginateWith originates a channel as described by req.
+func (a *AppInstance) ChannelsOriginateWith(req OriginateRequest) (*Channel, error) {
+	var err error
+	url := fmt.Sprintf("/channels")
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters for originating a channel.",
+	})
 	var r Channel
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -553,16 +762,16 @@ func (a *AppInstance) ChannelsOriginate(Endpoint string, options ...string) (*Ch
 
 func (a *AppInstance) ChannelsGet(ChannelID string) (*Channel, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Channel not found",
+	})
 	var r Channel
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -570,7 +779,7 @@ func (a *AppInstance) ChannelsGet(ChannelID string) (*Channel, error) {
 
 func (a *AppInstance) ChannelsOriginateWithID(ChannelID string, Endpoint string, options ...string) (*Channel, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["endpoint"] = Endpoint
 	url := fmt.Sprintf("/channels/%s", ChannelID)
 	for index, value := range options {
@@ -613,14 +822,17 @@ func (a *AppInstance) ChannelsOriginateWithID(ChannelID string, Endpoint string,
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters for originating a channel.")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters for originating a channel.",
+	})
 	var r Channel
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -628,7 +840,7 @@ func (a *AppInstance) ChannelsOriginateWithID(ChannelID string, Endpoint string,
 
 func (a *AppInstance) ChannelsHangup(ChannelID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s", ChannelID)
 	for index, value := range options {
 		switch index {
@@ -638,22 +850,40 @@ func (a *AppInstance) ChannelsHangup(ChannelID string, options ...string) error
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid reason for hangup provided")
-	case 404:
-		err = errors.New("Channel not found")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		400: "Invalid reason for hangup provided",
+		404: "Channel not found",
+	})
+	return err
+}
+
+// ChannelsHangupWith hangs up a channel as described by req.
+func (a *AppInstance) ChannelsHangupWith(ChannelID string, req HangupRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s", ChannelID)
+	url, body := commandParams("DELETE", url, req)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		400: "Invalid reason for hangup provided",
+		404: "Channel not found",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsContinueInDialplan(ChannelID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/continue", ChannelID)
 	for index, value := range options {
 		switch index {
@@ -671,73 +901,89 @@ func (a *AppInstance) ChannelsContinueInDialplan(ChannelID string, options ...st
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	return err
+}
+
+// ChannelsContinueInDialplanWith exits the application and continues execution
+// of the channel in the dialplan location described by req.
+func (a *AppInstance) ChannelsContinueInDialplanWith(ChannelID string, req ContinueRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s/continue", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsAnswer(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/answer", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsRing(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/ring", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsRingStop(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/ring", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsSendDTMF(ChannelID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/dtmf", ChannelID)
 	for index, value := range options {
 		switch index {
@@ -763,24 +1009,42 @@ func (a *AppInstance) ChannelsSendDTMF(ChannelID string, options ...string) erro
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("DTMF is required")
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "DTMF is required",
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	return err
+}
+
+// ChannelsSendDTMFWith sends DTMF digits to a channel as described by req.
+func (a *AppInstance) ChannelsSendDTMFWith(ChannelID string, req DTMFRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s/dtmf", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "DTMF is required",
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsMute(ChannelID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/mute", ChannelID)
 	for index, value := range options {
 		switch index {
@@ -790,22 +1054,40 @@ func (a *AppInstance) ChannelsMute(ChannelID string, options ...string) error {
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	return err
+}
+
+// ChannelsMuteWith mutes a channel as described by req.
+func (a *AppInstance) ChannelsMuteWith(ChannelID string, req MuteRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s/mute", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsUnmute(ChannelID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/mute", ChannelID)
 	for index, value := range options {
 		switch index {
@@ -815,56 +1097,72 @@ func (a *AppInstance) ChannelsUnmute(ChannelID string, options ...string) error
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	return err
+}
+
+// ChannelsUnmuteWith unmutes a channel as described by req.
+func (a *AppInstance) ChannelsUnmuteWith(ChannelID string, req MuteRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s/mute", ChannelID)
+	url, body := commandParams("DELETE", url, req)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsHold(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/hold", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsUnhold(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/hold", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsStartMoh(ChannelID string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/moh", ChannelID)
 	for index, value := range options {
 		switch index {
@@ -874,73 +1172,88 @@ func (a *AppInstance) ChannelsStartMoh(ChannelID string, options ...string) erro
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	return err
+}
+
+// ChannelsStartMohWith plays music on hold to a channel as described by req.
+func (a *AppInstance) ChannelsStartMohWith(ChannelID string, req MohRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s/moh", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsStopMoh(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/moh", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsStartSilence(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/silence", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsStopSilence(ChannelID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/channels/%s/silence", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsPlay(ChannelID string, Media string, options ...string) (*Playback, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["media"] = Media
 	url := fmt.Sprintf("/channels/%s/play", ChannelID)
 	for index, value := range options {
@@ -963,16 +1276,36 @@ func (a *AppInstance) ChannelsPlay(ChannelID string, Media string, options ...st
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	var r Playback
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// ChannelsPlayWith starts playback of media on a channel as described by req.
+func (a *AppInstance) ChannelsPlayWith(ChannelID string, req PlayRequest) (*Playback, error) {
+	var err error
+	url := fmt.Sprintf("/channels/%s/play", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	var r Playback
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -980,7 +1313,7 @@ func (a *AppInstance) ChannelsPlay(ChannelID string, Media string, options ...st
 
 func (a *AppInstance) ChannelsPlayWithID(ChannelID string, PlaybackID string, Media string, options ...string) (*Playback, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["media"] = Media
 	url := fmt.Sprintf("/channels/%s/play/%s", ChannelID, PlaybackID)
 	for index, value := range options {
@@ -999,16 +1332,18 @@ func (a *AppInstance) ChannelsPlayWithID(ChannelID string, PlaybackID string, Me
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	var r Playback
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1016,7 +1351,7 @@ func (a *AppInstance) ChannelsPlayWithID(ChannelID string, PlaybackID string, Me
 
 func (a *AppInstance) ChannelsRecord(ChannelID string, Name string, Format string, options ...string) (*LiveRecording, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["name"] = Name
 	paramMap["format"] = Format
 	url := fmt.Sprintf("/channels/%s/record", ChannelID)
@@ -1044,20 +1379,40 @@ func (a *AppInstance) ChannelsRecord(ChannelID string, Name string, Format strin
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters")
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel is not in a Stasis application; the channel is currently bridged with other hcannels; A recording with the same name already exists on the system and can not be overwritten because it is in progress or ifExists=fail")
-	case 422:
-		err = errors.New("The format specified is unknown on this system")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Channel not found",
+		409: "Channel is not in a Stasis application; the channel is currently bridged with other hcannels; A recording with the same name already exists on the system and can not be overwritten because it is in progress or ifExists=fail",
+		422: "The format specified is unknown on this system",
+	})
+	var r LiveRecording
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// ChannelsRecordWith starts a recording of a channel as described by req.
+func (a *AppInstance) ChannelsRecordWith(ChannelID string, req RecordRequest) (*LiveRecording, error) {
+	var err error
+	url := fmt.Sprintf("/channels/%s/record", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Channel not found",
+		409: "Channel is not in a Stasis application; the channel is currently bridged with other hcannels; A recording with the same name already exists on the system and can not be overwritten because it is in progress or ifExists=fail",
+		422: "The format specified is unknown on this system",
+	})
 	var r LiveRecording
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1065,21 +1420,19 @@ func (a *AppInstance) ChannelsRecord(ChannelID string, Name string, Format strin
 
 func (a *AppInstance) ChannelsGetChannelVar(ChannelID string, Var string) (*Variable, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["variable"] = Var
 	url := fmt.Sprintf("/channels/%s/variable", ChannelID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Missing variable parameter.")
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		400: "Missing variable parameter.",
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	var r Variable
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1087,7 +1440,7 @@ func (a *AppInstance) ChannelsGetChannelVar(ChannelID string, Var string) (*Vari
 
 func (a *AppInstance) ChannelsSetChannelVar(ChannelID string, Var string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["variable"] = Var
 	url := fmt.Sprintf("/channels/%s/variable", ChannelID)
 	for index, value := range options {
@@ -1098,24 +1451,42 @@ func (a *AppInstance) ChannelsSetChannelVar(ChannelID string, Var string, option
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Missing variable parameter.")
-	case 404:
-		err = errors.New("Channel not found")
-	case 409:
-		err = errors.New("Channel not in a Stasis application")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
 	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Missing variable parameter.",
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
+	return err
+}
+
+// ChannelsSetChannelVarWith sets the value of a channel variable as described by req.
+func (a *AppInstance) ChannelsSetChannelVarWith(ChannelID string, req VariableRequest) error {
+	var err error
+	url := fmt.Sprintf("/channels/%s/variable", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Missing variable parameter.",
+		404: "Channel not found",
+		409: "Channel not in a Stasis application",
+	})
 	return err
 }
 
 func (a *AppInstance) ChannelsSnoopChannel(ChannelID string, App string, options ...string) (*Channel, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["app"] = App
 	url := fmt.Sprintf("/channels/%s/snoop", ChannelID)
 	for index, value := range options {
@@ -1138,16 +1509,36 @@ func (a *AppInstance) ChannelsSnoopChannel(ChannelID string, App string, options
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters")
-	case 404:
-		err = errors.New("Channel not found")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Channel not found",
+	})
+	var r Channel
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// ChannelsSnoopChannelWith starts snooping on a channel as described by req.
+func (a *AppInstance) ChannelsSnoopChannelWith(ChannelID string, req SnoopRequest) (*Channel, error) {
+	var err error
+	url := fmt.Sprintf("/channels/%s/snoop", ChannelID)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Channel not found",
+	})
 	var r Channel
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1155,7 +1546,7 @@ func (a *AppInstance) ChannelsSnoopChannel(ChannelID string, App string, options
 
 func (a *AppInstance) ChannelsSnoopChannelWithID(ChannelID string, SnoopID string, App string, options ...string) (*Channel, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["app"] = App
 	url := fmt.Sprintf("/channels/%s/snoop/%s", ChannelID, SnoopID)
 	for index, value := range options {
@@ -1174,16 +1565,18 @@ func (a *AppInstance) ChannelsSnoopChannelWithID(ChannelID string, SnoopID strin
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters")
-	case 404:
-		err = errors.New("Channel not found")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "Invalid parameters",
+		404: "Channel not found",
+	})
 	var r Channel
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1191,11 +1584,14 @@ func (a *AppInstance) ChannelsSnoopChannelWithID(ChannelID string, SnoopID strin
 
 func (a *AppInstance) DeviceStatesList() (*[]DeviceState, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/deviceStates")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []DeviceState
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1203,11 +1599,14 @@ func (a *AppInstance) DeviceStatesList() (*[]DeviceState, error) {
 
 func (a *AppInstance) DeviceStatesGet(DeviceName string) (*DeviceState, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/deviceStates/%s", DeviceName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r DeviceState
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1215,46 +1614,47 @@ func (a *AppInstance) DeviceStatesGet(DeviceName string) (*DeviceState, error) {
 
 func (a *AppInstance) DeviceStatesUpdate(DeviceName string, DeviceState string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["deviceState"] = DeviceState
 	url := fmt.Sprintf("/deviceStates/%s", DeviceName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "PUT")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Device name is missing")
-	case 409:
-		err = errors.New("Uncontrolled device specified")
-	default:
-		err = nil
-	}
+	url, body := commandParams("PUT", url, paramMap)
+	result, err := a.processCommand(url, body, "PUT")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "PUT", url, map[int]string{
+		404: "Device name is missing",
+		409: "Uncontrolled device specified",
+	})
 	return err
 }
 
 func (a *AppInstance) DeviceStatesDelete(DeviceName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/deviceStates/%s", DeviceName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Device name is missing")
-	case 409:
-		err = errors.New("Uncontrolled device specified")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Device name is missing",
+		409: "Uncontrolled device specified",
+	})
 	return err
 }
 
 func (a *AppInstance) EndpointsList() (*[]Endpoint, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/endpoints")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []Endpoint
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1262,7 +1662,7 @@ func (a *AppInstance) EndpointsList() (*[]Endpoint, error) {
 
 func (a *AppInstance) EndpointsSendMessage(To string, From string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["to"] = To
 	paramMap["from"] = From
 	url := fmt.Sprintf("/endpoints/sendMessage")
@@ -1278,29 +1678,48 @@ func (a *AppInstance) EndpointsSendMessage(To string, From string, options ...st
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "PUT")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Endpoint not found")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
 	}
+	url, body := commandParams("PUT", url, paramMap)
+	result, err := a.processCommand(url, body, "PUT")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "PUT", url, map[int]string{
+		404: "Endpoint not found",
+	})
+	return err
+}
+
+// EndpointsSendMessageWith sends the text message described by req to the
+// endpoint given in its To field.
+func (a *AppInstance) EndpointsSendMessageWith(req SendMessageRequest) error {
+	var err error
+	url := fmt.Sprintf("/endpoints/sendMessage")
+	url, body := commandParams("PUT", url, req)
+	result, err := a.processCommand(url, body, "PUT")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "PUT", url, map[int]string{
+		404: "Endpoint not found",
+	})
 	return err
 }
 
 func (a *AppInstance) EndpointsListByTech(Tech string) (*[]Endpoint, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/endpoints/%s", Tech)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Endpoints not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Endpoints not found",
+	})
 	var r []Endpoint
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1308,18 +1727,17 @@ func (a *AppInstance) EndpointsListByTech(Tech string) (*[]Endpoint, error) {
 
 func (a *AppInstance) EndpointsGet(Tech string, Resource string) (*Endpoint, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/endpoints/%s/%s", Tech, Resource)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters for sending a message.")
-	case 404:
-		err = errors.New("Endpoints not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		400: "Invalid parameters for sending a message.",
+		404: "Endpoints not found",
+	})
 	var r Endpoint
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1327,7 +1745,7 @@ func (a *AppInstance) EndpointsGet(Tech string, Resource string) (*Endpoint, err
 
 func (a *AppInstance) EndpointsSendMessageToEndpoint(Tech string, Resource string, From string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["from"] = From
 	url := fmt.Sprintf("/endpoints/%s/%s/sendMessage", Tech, Resource)
 	for index, value := range options {
@@ -1342,27 +1760,48 @@ func (a *AppInstance) EndpointsSendMessageToEndpoint(Tech string, Resource strin
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "PUT")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("Invalid parameters for sending a message.")
-	case 404:
-		err = errors.New("Endpoint not found")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("PUT", url, paramMap)
+	result, err := a.processCommand(url, body, "PUT")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "PUT", url, map[int]string{
+		400: "Invalid parameters for sending a message.",
+		404: "Endpoint not found",
+	})
+	return err
+}
+
+// EndpointsSendMessageToEndpointWith sends a text message to an endpoint as described by req.
+func (a *AppInstance) EndpointsSendMessageToEndpointWith(Tech string, Resource string, req SendMessageRequest) error {
+	var err error
+	url := fmt.Sprintf("/endpoints/%s/%s/sendMessage", Tech, Resource)
+	url, body := commandParams("PUT", url, req)
+	result, err := a.processCommand(url, body, "PUT")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "PUT", url, map[int]string{
+		400: "Invalid parameters for sending a message.",
+		404: "Endpoint not found",
+	})
 	return err
 }
 
 func (a *AppInstance) EventsEventWebsocket(App string) (*Message, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["app"] = App
 	url := fmt.Sprintf("/events")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r Message
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1370,7 +1809,7 @@ func (a *AppInstance) EventsEventWebsocket(App string) (*Message, error) {
 
 func (a *AppInstance) EventsUserEvent(EventName string, Application string, options ...string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["application"] = Application
 	url := fmt.Sprintf("/events/user/%s", EventName)
 	for index, value := range options {
@@ -1385,28 +1824,49 @@ func (a *AppInstance) EventsUserEvent(EventName string, Application string, opti
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Application does not exist.")
-	case 422:
-		err = errors.New("Event source not found.")
-	case 400:
-		err = errors.New("Invalid even tsource URI or userevent data.")
-	default:
-		err = nil
+	if err = typedParams(paramMap); err != nil {
+		return err
+	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
 	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Application does not exist.",
+		422: "Event source not found.",
+		400: "Invalid even tsource URI or userevent data.",
+	})
+	return err
+}
+
+// EventsUserEventWith generates a user event as described by req.
+func (a *AppInstance) EventsUserEventWith(EventName string, req UserEventRequest) error {
+	var err error
+	url := fmt.Sprintf("/events/user/%s", EventName)
+	url, body := commandParams("POST", url, req)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Application does not exist.",
+		422: "Event source not found.",
+		400: "Invalid even tsource URI or userevent data.",
+	})
 	return err
 }
 
 func (a *AppInstance) MailboxesList() (*[]Mailbox, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/mailboxes")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []Mailbox
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1414,16 +1874,16 @@ func (a *AppInstance) MailboxesList() (*[]Mailbox, error) {
 
 func (a *AppInstance) MailboxesGet(MailboxName string) (*Mailbox, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/mailboxes/%s", MailboxName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Mailbox not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Mailbox not found",
+	})
 	var r Mailbox
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1431,45 +1891,48 @@ func (a *AppInstance) MailboxesGet(MailboxName string) (*Mailbox, error) {
 
 func (a *AppInstance) MailboxesUpdate(MailboxName string, OldMessages int, NewMessages int) error {
 	var err error
+	paramMap := make(map[string]interface{})
+	paramMap["oldMessages"] = OldMessages
+	paramMap["newMessages"] = NewMessages
 	url := fmt.Sprintf("/mailboxes/%s", MailboxName)
-	body := fmt.Sprintf("{\"oldMessages\": %d, \"newMessages\": %d }", OldMessages, NewMessages)
-	result := a.processCommand(url, body, "PUT")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Mailbox not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("PUT", url, paramMap)
+	result, err := a.processCommand(url, body, "PUT")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "PUT", url, map[int]string{
+		404: "Mailbox not found",
+	})
 	return err
 }
 
 func (a *AppInstance) MailboxesDelete(MailboxName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/mailboxes/%s", MailboxName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Mailbox not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Mailbox not found",
+	})
 	return err
 }
 
 func (a *AppInstance) PlaybacksGet(PlaybackID string) (*Playback, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/playbacks/%s", PlaybackID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("The playback cannot be found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "The playback cannot be found",
+	})
 	var r Playback
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1477,46 +1940,47 @@ func (a *AppInstance) PlaybacksGet(PlaybackID string) (*Playback, error) {
 
 func (a *AppInstance) PlaybacksStop(PlaybackID string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/playbacks/%s", PlaybackID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("The playback cannot be found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "The playback cannot be found",
+	})
 	return err
 }
 
 func (a *AppInstance) PlaybacksControl(PlaybackID string, Operation string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["operation"] = Operation
 	url := fmt.Sprintf("/playbacks/%s/control", PlaybackID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 400:
-		err = errors.New("The provided operation parameter was invalid")
-	case 404:
-		err = errors.New("The playback cannot be found")
-	case 409:
-		err = errors.New("The operation cannot be performed in the playback's current state")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		400: "The provided operation parameter was invalid",
+		404: "The playback cannot be found",
+		409: "The operation cannot be performed in the playback's current state",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsListStored() (*[]StoredRecording, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/stored")
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []StoredRecording
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1524,16 +1988,16 @@ func (a *AppInstance) RecordingsListStored() (*[]StoredRecording, error) {
 
 func (a *AppInstance) RecordingsGetStored(RecordingName string) (*StoredRecording, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/stored/%s", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Recording not found",
+	})
 	var r StoredRecording
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1541,34 +2005,33 @@ func (a *AppInstance) RecordingsGetStored(RecordingName string) (*StoredRecordin
 
 func (a *AppInstance) RecordingsDeleteStored(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/stored/%s", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Recording not found",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsCopyStored(RecordingName string, DestinationRecordingName string) (*StoredRecording, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	paramMap["destinationRecordingName"] = DestinationRecordingName
 	url := fmt.Sprintf("/recordings/stored/%s/copy", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	case 409:
-		err = errors.New("A recording with the same name already exists on the system")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Recording not found",
+		409: "A recording with the same name already exists on the system",
+	})
 	var r StoredRecording
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1576,16 +2039,16 @@ func (a *AppInstance) RecordingsCopyStored(RecordingName string, DestinationReco
 
 func (a *AppInstance) RecordingsGetLive(RecordingName string) (*LiveRecording, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, map[int]string{
+		404: "Recording not found",
+	})
 	var r LiveRecording
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1593,105 +2056,101 @@ func (a *AppInstance) RecordingsGetLive(RecordingName string) (*LiveRecording, e
 
 func (a *AppInstance) RecordingsCancel(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Recording not found",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsStop(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s/stop", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Recording not found",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsPause(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s/pause", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	case 409:
-		err = errors.New("Recording not in session")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Recording not found",
+		409: "Recording not in session",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsUnpause(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s/pause", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	case 409:
-		err = errors.New("Recording not in session")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Recording not found",
+		409: "Recording not in session",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsMute(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s/mute", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "POST")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	case 409:
-		err = errors.New("Recording not in session")
-	default:
-		err = nil
-	}
+	url, body := commandParams("POST", url, paramMap)
+	result, err := a.processCommand(url, body, "POST")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "POST", url, map[int]string{
+		404: "Recording not found",
+		409: "Recording not in session",
+	})
 	return err
 }
 
 func (a *AppInstance) RecordingsUnmute(RecordingName string) error {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/recordings/live/%s/mute", RecordingName)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "DELETE")
-	switch result.StatusCode {
-	case 404:
-		err = errors.New("Recording not found")
-	case 409:
-		err = errors.New("Recording not in session")
-	default:
-		err = nil
-	}
+	url, body := commandParams("DELETE", url, paramMap)
+	result, err := a.processCommand(url, body, "DELETE")
+	if err != nil {
+		return err
+	}
+	err = responseError(result, "DELETE", url, map[int]string{
+		404: "Recording not found",
+		409: "Recording not in session",
+	})
 	return err
 }
 
 func (a *AppInstance) SoundsList(options ...string) (*[]Sound, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/sounds")
 	for index, value := range options {
 		switch index {
@@ -1705,9 +2164,30 @@ func (a *AppInstance) SoundsList(options ...string) (*[]Sound, error) {
 			}
 		}
 	}
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	if err = typedParams(paramMap); err != nil {
+		return nil, err
+	}
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
+	var r []Sound
+	json.Unmarshal([]byte(result.ResponseBody), &r)
+	return &r, err
+}
+
+// SoundsListWith lists the sounds available on the system as described by req.
+func (a *AppInstance) SoundsListWith(req SoundsListRequest) (*[]Sound, error) {
+	var err error
+	url := fmt.Sprintf("/sounds")
+	url, body := commandParams("GET", url, req)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r []Sound
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
@@ -1715,11 +2195,14 @@ func (a *AppInstance) SoundsList(options ...string) (*[]Sound, error) {
 
 func (a *AppInstance) SoundsGet(SoundID string) (*Sound, error) {
 	var err error
-	paramMap := make(map[string]string)
+	paramMap := make(map[string]interface{})
 	url := fmt.Sprintf("/sounds/%s", SoundID)
-	body := buildJSON(paramMap)
-	result := a.processCommand(url, body, "GET")
-	err = nil
+	url, body := commandParams("GET", url, paramMap)
+	result, err := a.processCommand(url, body, "GET")
+	if err != nil {
+		return nil, err
+	}
+	err = responseError(result, "GET", url, nil)
 	var r Sound
 	json.Unmarshal([]byte(result.ResponseBody), &r)
 	return &r, err
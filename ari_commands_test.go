@@ -0,0 +1,388 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTestInstance creates an application instance on a Memory bus of its own,
+// answering each of its commands with the given status and body, or never
+// with a status of zero. The commands received are sent on the returned
+// channel.
+func newTestInstance(t *testing.T, status int, body string) (*AppInstance, chan Command) {
+	client, err := NewClient("MEMORY", MemoryConfig{Broker: "test-" + UUID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := client.InitAppInstance("d1")
+	responder := client.InitResponder(CommandsTopic("d1"))
+	commands := make(chan Command, 16)
+	go func() {
+		for request := range responder {
+			var cmd Command
+			json.Unmarshal(request.Body, &cmd)
+			commands <- cmd
+			if status == 0 {
+				continue
+			}
+			response, _ := json.Marshal(CommandResponse{UniqueID: cmd.UniqueID, StatusCode: status, ResponseBody: body})
+			request.Reply(response)
+		}
+	}()
+	t.Cleanup(func() {
+		a.Close()
+		client.bus.StopResponder(responder)
+	})
+	return a, commands
+}
+
+// commandGolden lists every command, with the method, URL and body of the
+// request it sends to ARI.
+var commandGolden = []struct {
+	name   string
+	call   func(a *AppInstance) error
+	method string
+	url    string
+	body   string
+}{
+	{"ApplicationsList", func(a *AppInstance) error { _, err := a.ApplicationsList(); return err },
+		"GET", `/applications`, ``},
+	{"ApplicationsGet", func(a *AppInstance) error { _, err := a.ApplicationsGet("app1"); return err },
+		"GET", `/applications/app1`, ``},
+	{"ApplicationsSubscribe", func(a *AppInstance) error { _, err := a.ApplicationsSubscribe("app1", "channel:c1"); return err },
+		"POST", `/applications/app1/subscription`, `{"eventSource":"channel:c1"}`},
+	{"ApplicationsUnsubscribe", func(a *AppInstance) error { _, err := a.ApplicationsUnsubscribe("app1", "channel:c1"); return err },
+		"DELETE", `/applications/app1/subscription?eventSource=channel%3Ac1`, ``},
+	{"AsteriskGetInfo", func(a *AppInstance) error { _, err := a.AsteriskGetInfo("build,system"); return err },
+		"GET", `/asterisk/info?only=build%2Csystem`, ``},
+	{"AsteriskGetInfoWith", func(a *AppInstance) error {
+		_, err := a.AsteriskGetInfoWith(AsteriskInfoRequest{Only: "status"})
+		return err
+	},
+		"GET", `/asterisk/info?only=status`, ``},
+	{"AsteriskGetGlobalVar", func(a *AppInstance) error { _, err := a.AsteriskGetGlobalVar("GLOBAL(X)"); return err },
+		"GET", `/asterisk/variable?variable=GLOBAL%28X%29`, ``},
+	{"AsteriskSetGlobalVar", func(a *AppInstance) error { return a.AsteriskSetGlobalVar("X", "a b") },
+		"POST", `/asterisk/variable`, `{"value":"a b","variable":"X"}`},
+	{"AsteriskSetGlobalVarWith", func(a *AppInstance) error {
+		return a.AsteriskSetGlobalVarWith(VariableRequest{Variable: "X", Value: "1"})
+	},
+		"POST", `/asterisk/variable`, `{"variable":"X","value":"1"}`},
+	{"BridgesList", func(a *AppInstance) error { _, err := a.BridgesList(); return err },
+		"GET", `/bridges`, ``},
+	{"BridgesCreate", func(a *AppInstance) error { _, err := a.BridgesCreate("mixing,dtmf_events", "b1", "conf"); return err },
+		"POST", `/bridges`, `{"bridgeId":"b1","name":"conf","type":"mixing,dtmf_events"}`},
+	{"BridgesCreateWith", func(a *AppInstance) error {
+		_, err := a.BridgesCreateWith(BridgeRequest{Type: "holding", Name: "hold"})
+		return err
+	},
+		"POST", `/bridges`, `{"type":"holding","name":"hold"}`},
+	{"BridgesCreate_Or_Update_With_ID", func(a *AppInstance) error {
+		_, err := a.BridgesCreate_Or_Update_With_ID("b1", "mixing", "conf")
+		return err
+	},
+		"POST", `/bridges/b1`, `{"name":"conf","type":"mixing"}`},
+	{"BridgesGet", func(a *AppInstance) error { _, err := a.BridgesGet("b1"); return err },
+		"GET", `/bridges/b1`, ``},
+	{"BridgesDestroy", func(a *AppInstance) error { return a.BridgesDestroy("b1") },
+		"DELETE", `/bridges/b1`, ``},
+	{"BridgesAddChannel", func(a *AppInstance) error { return a.BridgesAddChannel("b1", "c1,c2", "partymember") },
+		"POST", `/bridges/b1/addChannel`, `{"channel":"c1,c2","role":"partymember"}`},
+	{"BridgesAddChannelWith", func(a *AppInstance) error { return a.BridgesAddChannelWith("b1", AddChannelRequest{Channel: "c1"}) },
+		"POST", `/bridges/b1/addChannel`, `{"channel":"c1"}`},
+	{"BridgesRemoveChannel", func(a *AppInstance) error { return a.BridgesRemoveChannel("b1", "c1") },
+		"POST", `/bridges/b1/removeChannel`, `{"channel":"c1"}`},
+	{"BridgesStartMoh", func(a *AppInstance) error { return a.BridgesStartMoh("b1", "jazz") },
+		"POST", `/bridges/b1/moh`, `{"mohClass":"jazz"}`},
+	{"BridgesStartMohWith", func(a *AppInstance) error { return a.BridgesStartMohWith("b1", MohRequest{}) },
+		"POST", `/bridges/b1/moh`, `{}`},
+	{"BridgesStopMoh", func(a *AppInstance) error { return a.BridgesStopMoh("b1") },
+		"DELETE", `/bridges/b1/moh`, ``},
+	{"BridgesPlay", func(a *AppInstance) error {
+		_, err := a.BridgesPlay("b1", "sound:hello", "en", "100", "3000", "p1")
+		return err
+	},
+		"POST", `/bridges/b1/play`, `{"lang":"en","media":"sound:hello","offsetms":100,"playbackId":"p1","skipms":3000}`},
+	{"BridgesPlayWith", func(a *AppInstance) error {
+		_, err := a.BridgesPlayWith("b1", PlayRequest{Media: "sound:hello", SkipMs: 500})
+		return err
+	},
+		"POST", `/bridges/b1/play`, `{"media":"sound:hello","skipms":500}`},
+	{"BridgesPlayWithID", func(a *AppInstance) error { _, err := a.BridgesPlayWithID("b1", "p1", "sound:hello", "en"); return err },
+		"POST", `/bridges/b1/play/p1`, `{"lang":"en","media":"sound:hello"}`},
+	{"BridgesRecord", func(a *AppInstance) error {
+		_, err := a.BridgesRecord("b1", "rec", "wav", "60", "5", "overwrite", "true", "#")
+		return err
+	},
+		"POST", `/bridges/b1/record`, `{"beep":true,"format":"wav","ifExists":"overwrite","maxDurationSeconds":60,"maxSilenceSeconds":5,"name":"rec","terminateOn":"#"}`},
+	{"BridgesRecordWith", func(a *AppInstance) error {
+		_, err := a.BridgesRecordWith("b1", RecordRequest{Name: "rec", Format: "wav", IfExists: "fail"})
+		return err
+	},
+		"POST", `/bridges/b1/record`, `{"name":"rec","format":"wav","ifExists":"fail"}`},
+	{"ChannelsList", func(a *AppInstance) error { _, err := a.ChannelsList(); return err },
+		"GET", `/channels`, ``},
+	{"ChannelsOriginate", func(a *AppInstance) error {
+		_, err := a.ChannelsOriginate("SIP/1", "100", "ctx", "1", "", "", `Bob "B" <1>`, "30", `{"A":"b\n"}`)
+		return err
+	},
+		"POST", `/channels`, `{"callerId":"Bob \"B\" \u003c1\u003e","context":"ctx","endpoint":"SIP/1","extension":"100","priority":1,"timeout":30,"variables":{"A":"b\n"}}`},
+	{"ChannelsOriginateWith", func(a *AppInstance) error {
+		_, err := a.ChannelsOriginateWith(OriginateRequest{Endpoint: "PJSIP/alice", App: "app1", AppArgs: "x,y", ChannelID: "c2"})
+		return err
+	},
+		"POST", `/channels`, `{"endpoint":"PJSIP/alice","app":"app1","appArgs":"x,y","channelId":"c2"}`},
+	{"ChannelsGet", func(a *AppInstance) error { _, err := a.ChannelsGet("c1"); return err },
+		"GET", `/channels/c1`, ``},
+	{"ChannelsOriginateWithID", func(a *AppInstance) error {
+		_, err := a.ChannelsOriginateWithID("c2", "SIP/1", "", "", "", "app1", "a", "", "10", "", "c3")
+		return err
+	},
+		"POST", `/channels/c2`, `{"app":"app1","appArgs":"a","endpoint":"SIP/1","otherChannelId":"c3","timeout":10}`},
+	{"ChannelsHangup", func(a *AppInstance) error { return a.ChannelsHangup("c1", "busy") },
+		"DELETE", `/channels/c1?reason=busy`, ``},
+	{"ChannelsHangupWith", func(a *AppInstance) error { return a.ChannelsHangupWith("c1", HangupRequest{Reason: "normal"}) },
+		"DELETE", `/channels/c1?reason=normal`, ``},
+	{"ChannelsContinueInDialplan", func(a *AppInstance) error { return a.ChannelsContinueInDialplan("c1", "ctx", "s", "2") },
+		"POST", `/channels/c1/continue`, `{"context":"ctx","extension":"s","priority":2}`},
+	{"ChannelsContinueInDialplanWith", func(a *AppInstance) error {
+		return a.ChannelsContinueInDialplanWith("c1", ContinueRequest{Context: "ctx"})
+	},
+		"POST", `/channels/c1/continue`, `{"context":"ctx"}`},
+	{"ChannelsAnswer", func(a *AppInstance) error { return a.ChannelsAnswer("c1") },
+		"POST", `/channels/c1/answer`, `{}`},
+	{"ChannelsRing", func(a *AppInstance) error { return a.ChannelsRing("c1") },
+		"POST", `/channels/c1/ring`, `{}`},
+	{"ChannelsRingStop", func(a *AppInstance) error { return a.ChannelsRingStop("c1") },
+		"DELETE", `/channels/c1/ring`, ``},
+	{"ChannelsSendDTMF", func(a *AppInstance) error { return a.ChannelsSendDTMF("c1", "12#", "100", "200", "300", "400") },
+		"POST", `/channels/c1/dtmf`, `{"after":400,"before":100,"between":200,"dtmf":"12#","duration":300}`},
+	{"ChannelsSendDTMFWith", func(a *AppInstance) error { return a.ChannelsSendDTMFWith("c1", DTMFRequest{DTMF: "*", Between: 50}) },
+		"POST", `/channels/c1/dtmf`, `{"dtmf":"*","between":50}`},
+	{"ChannelsMute", func(a *AppInstance) error { return a.ChannelsMute("c1", "in") },
+		"POST", `/channels/c1/mute`, `{"direction":"in"}`},
+	{"ChannelsMuteWith", func(a *AppInstance) error { return a.ChannelsMuteWith("c1", MuteRequest{Direction: "both"}) },
+		"POST", `/channels/c1/mute`, `{"direction":"both"}`},
+	{"ChannelsUnmute", func(a *AppInstance) error { return a.ChannelsUnmute("c1", "out") },
+		"DELETE", `/channels/c1/mute?direction=out`, ``},
+	{"ChannelsUnmuteWith", func(a *AppInstance) error { return a.ChannelsUnmuteWith("c1", MuteRequest{}) },
+		"DELETE", `/channels/c1/mute`, ``},
+	{"ChannelsHold", func(a *AppInstance) error { return a.ChannelsHold("c1") },
+		"POST", `/channels/c1/hold`, `{}`},
+	{"ChannelsUnhold", func(a *AppInstance) error { return a.ChannelsUnhold("c1") },
+		"DELETE", `/channels/c1/hold`, ``},
+	{"ChannelsStartMoh", func(a *AppInstance) error { return a.ChannelsStartMoh("c1", "default") },
+		"POST", `/channels/c1/moh`, `{"mohClass":"default"}`},
+	{"ChannelsStartMohWith", func(a *AppInstance) error { return a.ChannelsStartMohWith("c1", MohRequest{MohClass: "jazz"}) },
+		"POST", `/channels/c1/moh`, `{"mohClass":"jazz"}`},
+	{"ChannelsStopMoh", func(a *AppInstance) error { return a.ChannelsStopMoh("c1") },
+		"DELETE", `/channels/c1/moh`, ``},
+	{"ChannelsStartSilence", func(a *AppInstance) error { return a.ChannelsStartSilence("c1") },
+		"POST", `/channels/c1/silence`, `{}`},
+	{"ChannelsStopSilence", func(a *AppInstance) error { return a.ChannelsStopSilence("c1") },
+		"DELETE", `/channels/c1/silence`, ``},
+	{"ChannelsPlay", func(a *AppInstance) error {
+		_, err := a.ChannelsPlay("c1", "sound:hello", "fr", "", "", "p1")
+		return err
+	},
+		"POST", `/channels/c1/play`, `{"lang":"fr","media":"sound:hello","playbackId":"p1"}`},
+	{"ChannelsPlayWith", func(a *AppInstance) error {
+		_, err := a.ChannelsPlayWith("c1", PlayRequest{Media: "tone:ring", OffsetMs: 10})
+		return err
+	},
+		"POST", `/channels/c1/play`, `{"media":"tone:ring","offsetms":10}`},
+	{"ChannelsPlayWithID", func(a *AppInstance) error {
+		_, err := a.ChannelsPlayWithID("c1", "p1", "sound:hello", "", "0", "250")
+		return err
+	},
+		"POST", `/channels/c1/play/p1`, `{"media":"sound:hello","offsetms":0,"skipms":250}`},
+	{"ChannelsRecord", func(a *AppInstance) error {
+		_, err := a.ChannelsRecord("c1", "rec", "wav", "", "", "", "false")
+		return err
+	},
+		"POST", `/channels/c1/record`, `{"beep":false,"format":"wav","name":"rec"}`},
+	{"ChannelsRecordWith", func(a *AppInstance) error {
+		_, err := a.ChannelsRecordWith("c1", RecordRequest{Name: "n", Format: "wav", Beep: true})
+		return err
+	},
+		"POST", `/channels/c1/record`, `{"name":"n","format":"wav","beep":true}`},
+	{"ChannelsGetChannelVar", func(a *AppInstance) error { _, err := a.ChannelsGetChannelVar("c1", "CALLERID(num)"); return err },
+		"GET", `/channels/c1/variable?variable=CALLERID%28num%29`, ``},
+	{"ChannelsSetChannelVar", func(a *AppInstance) error { return a.ChannelsSetChannelVar("c1", "X", "line1\nline2") },
+		"POST", `/channels/c1/variable`, `{"value":"line1\nline2","variable":"X"}`},
+	{"ChannelsSetChannelVarWith", func(a *AppInstance) error { return a.ChannelsSetChannelVarWith("c1", VariableRequest{Variable: "X"}) },
+		"POST", `/channels/c1/variable`, `{"variable":"X"}`},
+	{"ChannelsSnoopChannel", func(a *AppInstance) error {
+		_, err := a.ChannelsSnoopChannel("c1", "spy", "in", "out", "a", "s1")
+		return err
+	},
+		"POST", `/channels/c1/snoop`, `{"app":"spy","appArgs":"a","snoopId":"s1","spy":"in","whisper":"out"}`},
+	{"ChannelsSnoopChannelWith", func(a *AppInstance) error {
+		_, err := a.ChannelsSnoopChannelWith("c1", SnoopRequest{App: "spy", Spy: "both"})
+		return err
+	},
+		"POST", `/channels/c1/snoop`, `{"app":"spy","spy":"both"}`},
+	{"ChannelsSnoopChannelWithID", func(a *AppInstance) error {
+		_, err := a.ChannelsSnoopChannelWithID("c1", "s1", "spy", "", "both")
+		return err
+	},
+		"POST", `/channels/c1/snoop/s1`, `{"app":"spy","whisper":"both"}`},
+	{"DeviceStatesList", func(a *AppInstance) error { _, err := a.DeviceStatesList(); return err },
+		"GET", `/deviceStates`, ``},
+	{"DeviceStatesGet", func(a *AppInstance) error { _, err := a.DeviceStatesGet("Stasis:d1"); return err },
+		"GET", `/deviceStates/Stasis:d1`, ``},
+	{"DeviceStatesUpdate", func(a *AppInstance) error { return a.DeviceStatesUpdate("Stasis:d1", "BUSY") },
+		"PUT", `/deviceStates/Stasis:d1`, `{"deviceState":"BUSY"}`},
+	{"DeviceStatesDelete", func(a *AppInstance) error { return a.DeviceStatesDelete("Stasis:d1") },
+		"DELETE", `/deviceStates/Stasis:d1`, ``},
+	{"EndpointsList", func(a *AppInstance) error { _, err := a.EndpointsList(); return err },
+		"GET", `/endpoints`, ``},
+	{"EndpointsSendMessage", func(a *AppInstance) error { return a.EndpointsSendMessage("pjsip:bob", "alice", "hi", `{"X":"1"}`) },
+		"PUT", `/endpoints/sendMessage`, `{"body":"hi","from":"alice","to":"pjsip:bob","variables":{"X":"1"}}`},
+	{"EndpointsSendMessageWith", func(a *AppInstance) error {
+		return a.EndpointsSendMessageWith(SendMessageRequest{To: "pjsip:bob", From: "alice"})
+	},
+		"PUT", `/endpoints/sendMessage`, `{"to":"pjsip:bob","from":"alice"}`},
+	{"EndpointsListByTech", func(a *AppInstance) error { _, err := a.EndpointsListByTech("PJSIP"); return err },
+		"GET", `/endpoints/PJSIP`, ``},
+	{"EndpointsGet", func(a *AppInstance) error { _, err := a.EndpointsGet("PJSIP", "bob"); return err },
+		"GET", `/endpoints/PJSIP/bob`, ``},
+	{"EndpointsSendMessageToEndpoint", func(a *AppInstance) error { return a.EndpointsSendMessageToEndpoint("PJSIP", "bob", "alice", "hi") },
+		"PUT", `/endpoints/PJSIP/bob/sendMessage`, `{"body":"hi","from":"alice"}`},
+	{"EndpointsSendMessageToEndpointWith", func(a *AppInstance) error {
+		return a.EndpointsSendMessageToEndpointWith("PJSIP", "bob", SendMessageRequest{From: "alice", Variables: map[string]string{"X": "1"}})
+	},
+		"PUT", `/endpoints/PJSIP/bob/sendMessage`, `{"from":"alice","variables":{"X":"1"}}`},
+	{"EventsEventWebsocket", func(a *AppInstance) error { _, err := a.EventsEventWebsocket("app1"); return err },
+		"GET", `/events?app=app1`, ``},
+	{"EventsUserEvent", func(a *AppInstance) error { return a.EventsUserEvent("ev", "app1", "channel:c1", `{"A":"1"}`) },
+		"POST", `/events/user/ev`, `{"application":"app1","source":"channel:c1","variables":{"A":"1"}}`},
+	{"EventsUserEventWith", func(a *AppInstance) error { return a.EventsUserEventWith("ev", UserEventRequest{Application: "app1"}) },
+		"POST", `/events/user/ev`, `{"application":"app1"}`},
+	{"MailboxesList", func(a *AppInstance) error { _, err := a.MailboxesList(); return err },
+		"GET", `/mailboxes`, ``},
+	{"MailboxesGet", func(a *AppInstance) error { _, err := a.MailboxesGet("m"); return err },
+		"GET", `/mailboxes/m`, ``},
+	{"MailboxesUpdate", func(a *AppInstance) error { return a.MailboxesUpdate("m", 1, 2) },
+		"PUT", `/mailboxes/m`, `{"newMessages":2,"oldMessages":1}`},
+	{"MailboxesDelete", func(a *AppInstance) error { return a.MailboxesDelete("m") },
+		"DELETE", `/mailboxes/m`, ``},
+	{"PlaybacksGet", func(a *AppInstance) error { _, err := a.PlaybacksGet("p1"); return err },
+		"GET", `/playbacks/p1`, ``},
+	{"PlaybacksStop", func(a *AppInstance) error { return a.PlaybacksStop("p1") },
+		"DELETE", `/playbacks/p1`, ``},
+	{"PlaybacksControl", func(a *AppInstance) error { return a.PlaybacksControl("p1", "pause") },
+		"POST", `/playbacks/p1/control`, `{"operation":"pause"}`},
+	{"RecordingsListStored", func(a *AppInstance) error { _, err := a.RecordingsListStored(); return err },
+		"GET", `/recordings/stored`, ``},
+	{"RecordingsGetStored", func(a *AppInstance) error { _, err := a.RecordingsGetStored("rec"); return err },
+		"GET", `/recordings/stored/rec`, ``},
+	{"RecordingsDeleteStored", func(a *AppInstance) error { return a.RecordingsDeleteStored("rec") },
+		"DELETE", `/recordings/stored/rec`, ``},
+	{"RecordingsCopyStored", func(a *AppInstance) error { _, err := a.RecordingsCopyStored("rec", "copy"); return err },
+		"POST", `/recordings/stored/rec/copy`, `{"destinationRecordingName":"copy"}`},
+	{"RecordingsGetLive", func(a *AppInstance) error { _, err := a.RecordingsGetLive("rec"); return err },
+		"GET", `/recordings/live/rec`, ``},
+	{"RecordingsCancel", func(a *AppInstance) error { return a.RecordingsCancel("rec") },
+		"DELETE", `/recordings/live/rec`, ``},
+	{"RecordingsStop", func(a *AppInstance) error { return a.RecordingsStop("rec") },
+		"POST", `/recordings/live/rec/stop`, `{}`},
+	{"RecordingsPause", func(a *AppInstance) error { return a.RecordingsPause("rec") },
+		"POST", `/recordings/live/rec/pause`, `{}`},
+	{"RecordingsUnpause", func(a *AppInstance) error { return a.RecordingsUnpause("rec") },
+		"DELETE", `/recordings/live/rec/pause`, ``},
+	{"RecordingsMute", func(a *AppInstance) error { return a.RecordingsMute("rec") },
+		"POST", `/recordings/live/rec/mute`, `{}`},
+	{"RecordingsUnmute", func(a *AppInstance) error { return a.RecordingsUnmute("rec") },
+		"DELETE", `/recordings/live/rec/mute`, ``},
+	{"SoundsList", func(a *AppInstance) error { _, err := a.SoundsList("en", "gsm"); return err },
+		"GET", `/sounds?format=gsm&lang=en`, ``},
+	{"SoundsListWith", func(a *AppInstance) error { _, err := a.SoundsListWith(SoundsListRequest{Lang: "en"}); return err },
+		"GET", `/sounds?lang=en`, ``},
+	{"SoundsGet", func(a *AppInstance) error { _, err := a.SoundsGet("hello-world"); return err },
+		"GET", `/sounds/hello-world`, ``},
+}
+
+func TestCommandGolden(t *testing.T) {
+	for _, c := range commandGolden {
+		t.Run(c.name, func(t *testing.T) {
+			a, commands := newTestInstance(t, 200, "{}")
+			if err := c.call(a); err != nil {
+				t.Fatal(err)
+			}
+			var cmd Command
+			select {
+			case cmd = <-commands:
+			default:
+				t.Fatal("No command sent.")
+			}
+			if cmd.Method != c.method || cmd.URL != c.url || cmd.Body != c.body {
+				t.Errorf("got %s %s %s, want %s %s %s", cmd.Method, cmd.URL, cmd.Body, c.method, c.url, c.body)
+			}
+		})
+	}
+}
+
+func TestCommandInvalidOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		call func(a *AppInstance) error
+		err  string
+	}{
+		{"timeout", func(a *AppInstance) error {
+			_, err := a.ChannelsOriginate("SIP/1", "", "", "", "app1", "", "", "abc")
+			return err
+		}, "Invalid value for timeout: abc"},
+		{"priority", func(a *AppInstance) error {
+			_, err := a.ChannelsOriginate("SIP/1", "100", "ctx", "1.5")
+			return err
+		}, "Invalid value for priority: 1.5"},
+		{"variables", func(a *AppInstance) error {
+			_, err := a.ChannelsOriginate("SIP/1", "", "", "", "app1", "", "", "", "A=b")
+			return err
+		}, "Invalid value for variables: A=b"},
+		{"offsetms", func(a *AppInstance) error {
+			_, err := a.ChannelsPlay("c1", "sound:hello", "", "ten")
+			return err
+		}, "Invalid value for offsetms: ten"},
+		{"beep", func(a *AppInstance) error {
+			_, err := a.BridgesRecord("b1", "rec", "wav", "", "", "", "maybe")
+			return err
+		}, "Invalid value for beep: maybe"},
+		{"between", func(a *AppInstance) error {
+			return a.ChannelsSendDTMF("c1", "1", "", "-")
+		}, "Invalid value for between: -"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, commands := newTestInstance(t, 200, "{}")
+			if err := c.call(a); err == nil || err.Error() != c.err {
+				t.Errorf("got %v, want %s", err, c.err)
+			}
+			select {
+			case cmd := <-commands:
+				t.Errorf("Command sent: %s %s", cmd.Method, cmd.URL)
+			default:
+			}
+		})
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	a, _ := newTestInstance(t, 0, "")
+	a.SetCommandTimeout(50 * time.Millisecond)
+	if err := a.ChannelsAnswer("c1"); err != ErrCommandTimeout {
+		t.Errorf("Command without a response failed with %v, want ErrCommandTimeout", err)
+	}
+}
+
+func TestCommandCancel(t *testing.T) {
+	a, _ := newTestInstance(t, 0, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := a.WithContext(ctx).ChannelsAnswer("c1"); err != context.Canceled {
+		t.Errorf("Cancelled command failed with %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,128 @@
+package ari
+
+// OriginateRequest holds the parameters for originating a channel with
+// ChannelsOriginateWith.
+type OriginateRequest struct {
+	Endpoint       string            `json:"endpoint"`
+	Extension      string            `json:"extension,omitempty"`
+	Context        string            `json:"context,omitempty"`
+	Priority       int64             `json:"priority,omitempty"`
+	App            string            `json:"app,omitempty"`
+	AppArgs        string            `json:"appArgs,omitempty"`
+	CallerID       string            `json:"callerId,omitempty"`
+	Timeout        int               `json:"timeout,omitempty"` // seconds
+	Variables      map[string]string `json:"variables,omitempty"`
+	ChannelID      string            `json:"channelId,omitempty"`
+	OtherChannelID string            `json:"otherChannelId,omitempty"`
+}
+
+// PlayRequest holds the parameters for starting a playback on a channel or a
+// bridge.
+type PlayRequest struct {
+	Media      string `json:"media"`
+	Lang       string `json:"lang,omitempty"`
+	OffsetMs   int    `json:"offsetms,omitempty"`
+	SkipMs     int    `json:"skipms,omitempty"`
+	PlaybackID string `json:"playbackId,omitempty"`
+}
+
+// RecordRequest holds the parameters for starting a recording of a channel or
+// a bridge.
+type RecordRequest struct {
+	Name               string `json:"name"`
+	Format             string `json:"format"`
+	MaxDurationSeconds int    `json:"maxDurationSeconds,omitempty"`
+	MaxSilenceSeconds  int    `json:"maxSilenceSeconds,omitempty"`
+	IfExists           string `json:"ifExists,omitempty"` // fail, overwrite or append
+	Beep               bool   `json:"beep,omitempty"`
+	TerminateOn        string `json:"terminateOn,omitempty"` // none, any, * or #
+}
+
+// SnoopRequest holds the parameters for snooping on a channel.
+type SnoopRequest struct {
+	App     string `json:"app"`
+	Spy     string `json:"spy,omitempty"`     // none, both, out or in
+	Whisper string `json:"whisper,omitempty"` // none, both, out or in
+	AppArgs string `json:"appArgs,omitempty"`
+	SnoopID string `json:"snoopId,omitempty"`
+}
+
+// BridgeRequest holds the parameters for creating a bridge.
+type BridgeRequest struct {
+	Type     string `json:"type,omitempty"` // comma separated list of bridge type attributes
+	BridgeID string `json:"bridgeId,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// AddChannelRequest holds the parameters for adding channels to a bridge.
+type AddChannelRequest struct {
+	Channel string `json:"channel"` // comma separated list of channel IDs
+	Role    string `json:"role,omitempty"`
+}
+
+// ContinueRequest holds the dialplan location a channel continues at when
+// leaving the Stasis application.
+type ContinueRequest struct {
+	Context   string `json:"context,omitempty"`
+	Extension string `json:"extension,omitempty"`
+	Priority  int    `json:"priority,omitempty"`
+}
+
+// DTMFRequest holds the digits to send to a channel and their timing, in
+// milliseconds.
+type DTMFRequest struct {
+	DTMF     string `json:"dtmf"`
+	Before   int    `json:"before,omitempty"`
+	Between  int    `json:"between,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	After    int    `json:"after,omitempty"`
+}
+
+// HangupRequest holds the reason for hanging up a channel.
+type HangupRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// MuteRequest holds the direction of the audio muted or unmuted on a channel.
+type MuteRequest struct {
+	Direction string `json:"direction,omitempty"` // both, in or out
+}
+
+// MohRequest holds the music on hold class played to a channel or a bridge.
+type MohRequest struct {
+	MohClass string `json:"mohClass,omitempty"`
+}
+
+// VariableRequest holds a global or channel variable to set.
+type VariableRequest struct {
+	Variable string `json:"variable"`
+	Value    string `json:"value,omitempty"`
+}
+
+// AsteriskInfoRequest holds the parameters for retrieving information about
+// Asterisk.
+type AsteriskInfoRequest struct {
+	Only string `json:"only,omitempty"` // comma separated list of build, system, config and status
+}
+
+// SendMessageRequest holds the parameters for sending a text message to an
+// endpoint. To is not used when sending to a given endpoint.
+type SendMessageRequest struct {
+	To        string            `json:"to,omitempty"`
+	From      string            `json:"from"`
+	Body      string            `json:"body,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// UserEventRequest holds the parameters for generating a user event.
+type UserEventRequest struct {
+	Application string            `json:"application"`
+	Source      string            `json:"source,omitempty"` // comma separated list of event source URIs
+	Variables   map[string]string `json:"variables,omitempty"`
+}
+
+// SoundsListRequest holds the filters for listing sounds.
+type SoundsListRequest struct {
+	Lang   string `json:"lang,omitempty"`
+	Format string `json:"format,omitempty"`
+}
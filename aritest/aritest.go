@@ -0,0 +1,274 @@
+// Package aritest provides a fake go-ari-proxy for end-to-end testing of
+// applications built on the ari package.
+//
+// A Proxy plays the proxy side of the protocol over the message bus of an
+// ari.Client, typically on the "MEMORY" bus: it starts application
+// instances by publishing AppStart, emits scripted events, answers commands
+// with programmable responses and records the commands it received so that a
+// test can assert on the call flow.
+//
+//	client, _ := ari.NewClient("MEMORY", map[string]interface{}{"broker": t.Name()})
+//	client.NewApp().Init("voicemail", handler)
+//	proxy := aritest.NewProxy()
+//	proxy.Client = client
+//	proxy.Respond("POST", "/channels/*/play", 201, `{"id": "playback-1"}`)
+//	dialog, _ := proxy.StartDialog("voicemail", "dialog-1")
+//	defer dialog.Close()
+//	dialog.SendEvent("StasisStart", ari.StasisStart{Channel: ari.Channel{Id: "channel-1"}})
+//	cmd, _ := dialog.WaitForCommand("POST", "/channels/channel-1/answer", time.Second)
+package aritest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nvisibleinc/go-ari-library"
+)
+
+// Responder computes the response to a command received by the proxy.
+type Responder func(cmd ari.Command) (statusCode int, body string)
+
+// route is a Responder for the commands matching a method and URL pattern.
+type route struct {
+	method    string
+	pattern   string
+	responder Responder
+}
+
+// Proxy is a fake ARI proxy.
+type Proxy struct {
+	Client   *ari.Client   // Client whose bus is used; ari.DefaultClient if nil.
+	ServerID string        // Sent as the server_id of AppStart messages and events.
+	Timeout  time.Duration // How long StartDialog waits for the application instance.
+
+	lock       sync.Mutex
+	routes     []route
+	appStarts  map[string]chan []byte
+	statusCode int
+	body       string
+}
+
+// Dialog is an application instance started by the proxy, i.e. a call.
+type Dialog struct {
+	ID    string
+	proxy *Proxy
+
+	events   chan []byte
+	commands chan *ari.BusRequest
+	done     chan struct{}
+
+	lock     sync.Mutex
+	closed   bool
+	received []ari.Command
+	arrived  *sync.Cond
+}
+
+// NewProxy creates a proxy which answers unscripted commands with a 204 No
+// Content response.
+func NewProxy() *Proxy {
+	return &Proxy{
+		ServerID:   "aritest",
+		Timeout:    2 * time.Second,
+		appStarts:  make(map[string]chan []byte),
+		statusCode: 204,
+	}
+}
+
+// Respond scripts the response to the commands with the given method whose URL
+// path matches pattern, as understood by path.Match, e.g. "/channels/*/play".
+// Routes are tried in the order they were added.
+func (p *Proxy) Respond(method string, pattern string, statusCode int, body string) {
+	p.RespondFunc(method, pattern, func(ari.Command) (int, string) {
+		return statusCode, body
+	})
+}
+
+// RespondFunc is like Respond but computes the response with a function.
+func (p *Proxy) RespondFunc(method string, pattern string, responder Responder) {
+	p.lock.Lock()
+	p.routes = append(p.routes, route{method: method, pattern: pattern, responder: responder})
+	p.lock.Unlock()
+}
+
+// SetDefaultResponse sets the response to the commands no route matches.
+func (p *Proxy) SetDefaultResponse(statusCode int, body string) {
+	p.lock.Lock()
+	p.statusCode = statusCode
+	p.body = body
+	p.lock.Unlock()
+}
+
+// client returns the client whose bus the proxy uses.
+func (p *Proxy) client() *ari.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return ari.DefaultClient
+}
+
+// respond computes the response to a command.
+func (p *Proxy) respond(cmd ari.Command) *ari.CommandResponse {
+	urlPath := strings.SplitN(cmd.URL, "?", 2)[0]
+	p.lock.Lock()
+	statusCode, body := p.statusCode, p.body
+	var responder Responder
+	for _, r := range p.routes {
+		if r.method != cmd.Method {
+			continue
+		}
+		if ok, _ := path.Match(r.pattern, urlPath); ok {
+			responder = r.responder
+			break
+		}
+	}
+	p.lock.Unlock()
+	if responder != nil {
+		statusCode, body = responder(cmd)
+	}
+	return &ari.CommandResponse{UniqueID: cmd.UniqueID, StatusCode: statusCode, ResponseBody: body}
+}
+
+// StartDialog starts an instance of the application by publishing an AppStart
+// on the topic of the application, and waits until the instance listens for
+// events.
+func (p *Proxy) StartDialog(app string, dialogID string) (*Dialog, error) {
+	d := &Dialog{ID: dialogID, proxy: p, done: make(chan struct{})}
+	d.arrived = sync.NewCond(&d.lock)
+	client := p.client()
+	d.events = client.InitProducer(ari.EventsTopic(dialogID))
+	d.commands = client.InitResponder(ari.CommandsTopic(dialogID))
+	if d.events == nil || d.commands == nil {
+		return nil, errors.New("Unable to set up the topics of the dialog.")
+	}
+	go d.processCommands()
+
+	p.lock.Lock()
+	appStart, ok := p.appStarts[app]
+	if !ok {
+		appStart = client.InitProducer(app)
+		p.appStarts[app] = appStart
+	}
+	p.lock.Unlock()
+	message, _ := json.Marshal(ari.AppStart{Application: app, DialogID: dialogID, ServerID: p.ServerID})
+	appStart <- message
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	if !client.WaitForTopic(ctx, ari.EventsTopic(dialogID)) {
+		d.Close()
+		return nil, fmt.Errorf("Application %s did not start an instance for dialog %s.", app, dialogID)
+	}
+	return d, nil
+}
+
+// processCommands records and answers the commands sent by the application
+// instance until the dialog is closed.
+func (d *Dialog) processCommands() {
+	for {
+		var request *ari.BusRequest
+		select {
+		case request = <-d.commands:
+		case <-d.done:
+			return
+		}
+		var cmd ari.Command
+		if err := json.Unmarshal(request.Body, &cmd); err != nil {
+			continue
+		}
+		d.lock.Lock()
+		d.received = append(d.received, cmd)
+		d.lock.Unlock()
+		d.arrived.Broadcast()
+		response, _ := json.Marshal(d.proxy.respond(cmd))
+		request.Reply(response)
+	}
+}
+
+// SendEvent emits an event to the application instance. The body is the ARI
+// event, e.g. an ari.StasisStart, or its JSON encoding as a string.
+func (d *Dialog) SendEvent(eventType string, body interface{}) error {
+	ariBody, ok := body.(string)
+	if !ok {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		ariBody = string(encoded)
+	}
+	message, err := json.Marshal(ari.Event{
+		ServerID:  d.proxy.ServerID,
+		Timestamp: time.Now(),
+		Type:      eventType,
+		ARI_Body:  ariBody,
+	})
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return errors.New("Dialog closed.")
+	}
+	d.events <- message
+	return nil
+}
+
+// Close ends the dialog: the proxy stops emitting its events and answering its
+// commands, which then fail in the application instance. Close may be called
+// several times.
+func (d *Dialog) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	close(d.done)
+	close(d.events)
+	return d.proxy.client().Bus().StopResponder(d.commands)
+}
+
+// Commands returns the commands received from the application instance so far,
+// in order.
+func (d *Dialog) Commands() []ari.Command {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	commands := make([]ari.Command, len(d.received))
+	copy(commands, d.received)
+	return commands
+}
+
+// WaitForCommand waits until the application instance sent a command with the
+// given method whose URL path matches pattern, and returns the first such
+// command.
+func (d *Dialog) WaitForCommand(method string, pattern string, timeout time.Duration) (ari.Command, error) {
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		d.lock.Lock()
+		expired = true
+		d.lock.Unlock()
+		d.arrived.Broadcast()
+	})
+	defer timer.Stop()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for checked := 0; ; d.arrived.Wait() {
+		for ; checked < len(d.received); checked++ {
+			cmd := d.received[checked]
+			urlPath := strings.SplitN(cmd.URL, "?", 2)[0]
+			if ok, _ := path.Match(pattern, urlPath); ok && cmd.Method == method {
+				return cmd, nil
+			}
+		}
+		if expired {
+			return ari.Command{}, fmt.Errorf("No %s %s command received.", method, pattern)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package aritest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nvisibleinc/go-ari-library"
+)
+
+func TestDialogClose(t *testing.T) {
+	client, _ := ari.NewClient("MEMORY", map[string]interface{}{"broker": t.Name()})
+	instances := make(chan *ari.AppInstance, 1)
+	app := client.NewApp()
+	app.Init("vm", func(a *ari.AppInstance) {
+		a.SetCommandTimeout(time.Second)
+		instances <- a
+		a.Run()
+	})
+	defer app.Shutdown(context.Background())
+
+	proxy := NewProxy()
+	proxy.Client = client
+	d, err := proxy.StartDialog("vm", "d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := <-instances
+	if err := a.ChannelsAnswer("c1"); err != nil {
+		t.Fatalf("Answer failed before Close: %v", err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+	if err := a.ChannelsAnswer("c1"); err == nil {
+		t.Error("Answer succeeded after Close")
+	}
+	if err := d.SendEvent("StasisEnd", ari.StasisEnd{Channel: ari.Channel{Id: "c1"}}); err == nil {
+		t.Error("SendEvent succeeded after Close")
+	}
+	if n := len(d.Commands()); n != 1 {
+		t.Errorf("%d commands received, want 1", n)
+	}
+}
+
+// TestVoicemailFlow drives a voicemail application which answers the call,
+// plays a greeting, records a message and hangs up once the recording is done.
+func TestVoicemailFlow(t *testing.T) {
+	client, _ := ari.NewClient("MEMORY", map[string]interface{}{"broker": t.Name()})
+	app := client.NewApp()
+	app.Init("voicemail", func(a *ari.AppInstance) {
+		a.OnStasisStart(func(e *ari.StasisStart) {
+			channel := a.NewChannelHandle(e.Channel)
+			channel.On("RecordingFinished", func(interface{}) {
+				channel.Hangup(ari.HangupRequest{})
+			})
+			channel.Answer()
+			channel.Play(ari.PlayRequest{Media: "sound:vm-intro"})
+			channel.Record(ari.RecordRequest{Name: "message", Format: "wav", Beep: true})
+		})
+		a.Run()
+	})
+	defer app.Shutdown(context.Background())
+
+	proxy := NewProxy()
+	proxy.Client = client
+	proxy.Respond("POST", "/channels/*/play", 201, `{"id":"playback-1","target_uri":"channel:channel-1"}`)
+	proxy.Respond("POST", "/channels/*/record", 201, `{"name":"message","target_uri":"channel:channel-1"}`)
+	d, err := proxy.StartDialog("voicemail", "dialog-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	d.SendEvent("StasisStart", ari.StasisStart{Channel: ari.Channel{Id: "channel-1"}})
+	if _, err := d.WaitForCommand("POST", "/channels/channel-1/record", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	d.SendEvent("RecordingFinished", ari.RecordingFinished{
+		Recording: ari.LiveRecording{Name: "message", Target_Uri: "channel:channel-1"}})
+	if _, err := d.WaitForCommand("DELETE", "/channels/channel-1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"POST /channels/channel-1/answer",
+		`POST /channels/channel-1/play {"media":"sound:vm-intro"}`,
+		`POST /channels/channel-1/record {"name":"message","format":"wav","beep":true}`,
+		"DELETE /channels/channel-1",
+	}
+	commands := d.Commands()
+	if len(commands) != len(want) {
+		t.Fatalf("Received %v, want %v", commands, want)
+	}
+	for i, cmd := range commands {
+		got := cmd.Method + " " + cmd.URL
+		if len(cmd.Body) > 0 && cmd.Body != "{}" {
+			got += " " + cmd.Body
+		}
+		if got != want[i] {
+			t.Errorf("Command %d is %s, want %s", i, got, want[i])
+		}
+	}
+}
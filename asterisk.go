@@ -0,0 +1,447 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// AsteriskConfig is the configuration of a connection to the ARI of an
+// Asterisk server.
+type AsteriskConfig struct {
+	URL          string   `json:"url"` // base URL of ARI, e.g. http://localhost:8088/ari
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	ServerID     string   `json:"server_id"`     // server_id of the events; the asterisk_id of the events by default
+	StartTimeout Duration `json:"start_timeout"` // how long to wait for an application instance to listen for events
+}
+
+// Asterisk is a MessageBus talking to the ARI of an Asterisk server directly,
+// without a message bus and a proxy in between, for small installs and for
+// development. It plays the proxy in the process: once an application listens
+// on its topic, it reads the events of the application from the ARI
+// WebSocket, starts an application instance with AppStart for each channel
+// entering the application, routes the events of the channel to the instance
+// and executes its commands over HTTP. Topics live in memory, as with the
+// Memory bus.
+//
+//	client, err := ari.NewClient("ASTERISK", ari.AsteriskConfig{
+//		URL: "http://localhost:8088/ari", Username: "asterisk", Password: "secret"})
+//	client.NewApp().Init("voicemail", handler)
+type Asterisk struct {
+	Memory
+	router *router
+	lock   sync.Mutex
+	apps   map[chan []byte]string // consumers of the topics of applications
+}
+
+func (a *Asterisk) InitBus(config interface{}) error {
+	var c AsteriskConfig
+	if err := decodeConfig(config, &c); err != nil {
+		return err
+	}
+	if err := a.Memory.InitBus(MemoryConfig{Broker: "asterisk-" + UUID()}); err != nil {
+		return err
+	}
+	a.apps = make(map[chan []byte]string)
+	a.router = newRouter(c, &a.Memory)
+	return nil
+}
+
+// StartConsumer subscribes to a topic; subscribing to the topic of an
+// application starts reading its events.
+func (a *Asterisk) StartConsumer(topic string) (chan []byte, error) {
+	c, err := a.Memory.StartConsumer(topic)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, ok := splitInstanceTopic(topic); !ok {
+		a.lock.Lock()
+		a.apps[c] = topic
+		a.lock.Unlock()
+		a.router.startApp(topic)
+	}
+	return c, nil
+}
+
+// StopConsumer unsubscribes from a topic; once the last consumer of the topic
+// of an application unsubscribes, the events of the application are no longer
+// read.
+func (a *Asterisk) StopConsumer(consumer chan []byte) error {
+	a.lock.Lock()
+	app, last := a.apps[consumer]
+	delete(a.apps, consumer)
+	for _, other := range a.apps {
+		if other == app {
+			last = false
+		}
+	}
+	a.lock.Unlock()
+	if last {
+		a.router.stopApp(app)
+	}
+	return a.Memory.StopConsumer(consumer)
+}
+
+// router connects the ARI of an Asterisk server to a message bus: it publishes
+// AppStart on the topic of an application for each channel entering it,
+// publishes the events of the channels of an application instance on its
+// events topic and answers the commands it sends on its commands topic.
+type router struct {
+	config   AsteriskConfig
+	bus      MessageBus
+	client   *http.Client
+	lock     sync.Mutex
+	apps     map[string]chan struct{} // applications read, and what stops reading them
+	starts   map[string]chan []byte   // producers of the topics of applications
+	dialogs  map[string]*dialog       // dialogs in progress by ID
+	registry *DialogRegistry
+}
+
+// dialog is an application instance started by a router.
+type dialog struct {
+	id       string
+	app      string
+	channels int // channels of the dialog in the applications; guarded by the lock of the router
+	lock     sync.Mutex
+	events   chan []byte // events waiting to be published, closed once the dialog ends
+	ended    bool
+	cancel   context.CancelFunc // stops waiting for the application instance
+}
+
+// publish queues an event of the dialog for publication, then ends the dialog
+// if it was the last one. Events of a dialog which ended are dropped.
+func (d *dialog) publish(event []byte, last bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.ended {
+		return
+	}
+	d.events <- event
+	if last {
+		d.ended = true
+		close(d.events)
+	}
+}
+
+// end ends the dialog when the proxy stops, without waiting for its last
+// event nor for its application instance to listen.
+func (d *dialog) end() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.cancel()
+	if !d.ended {
+		d.ended = true
+		close(d.events)
+	}
+}
+
+func newRouter(config AsteriskConfig, bus MessageBus) *router {
+	if config.StartTimeout <= 0 {
+		config.StartTimeout = Duration(5 * time.Second)
+	}
+	return &router{
+		config:   config,
+		bus:      bus,
+		client:   &http.Client{},
+		apps:     make(map[string]chan struct{}),
+		starts:   make(map[string]chan []byte),
+		dialogs:  make(map[string]*dialog),
+		registry: NewDialogRegistry(),
+	}
+}
+
+// startApp starts reading the events of an application, unless already
+// reading them.
+func (r *router) startApp(app string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.apps[app]; ok {
+		return
+	}
+	stop := make(chan struct{})
+	r.apps[app] = stop
+	go r.listen(app, stop)
+}
+
+// stopApp stops reading the events of an application, and ends its dialogs:
+// their events are no longer routed nor their commands answered.
+func (r *router) stopApp(app string) {
+	r.lock.Lock()
+	if stop, ok := r.apps[app]; ok {
+		close(stop)
+		delete(r.apps, app)
+	}
+	var ended []*dialog
+	for id, d := range r.dialogs {
+		if d.app == app {
+			delete(r.dialogs, id)
+			r.registry.Forget(id)
+			ended = append(ended, d)
+		}
+	}
+	r.lock.Unlock()
+	for _, d := range ended {
+		d.end()
+	}
+}
+
+// running returns the applications whose events are read.
+func (r *router) running() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	apps := make([]string, 0, len(r.apps))
+	for app := range r.apps {
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// eventsURL returns the URL of the WebSocket of the events of an application.
+func (r *router) eventsURL(app string) (string, error) {
+	u, err := url.Parse(strings.TrimRight(r.config.URL, "/") + "/events")
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	query := url.Values{}
+	query.Set("app", app)
+	query.Set("api_key", r.config.Username+":"+r.config.Password)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// listen reads the events of an application from the WebSocket until stopped,
+// connecting again whenever the connection is lost.
+func (r *router) listen(app string, stop chan struct{}) {
+	wait := time.Second
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		eventsURL, err := r.eventsURL(app)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(eventsURL, nil)
+		if err != nil {
+			fmt.Println(err)
+			select {
+			case <-time.After(wait):
+			case <-stop:
+				return
+			}
+			if wait *= 2; wait > 30*time.Second {
+				wait = 30 * time.Second
+			}
+			continue
+		}
+		wait = time.Second
+		closed := make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+				conn.Close()
+			case <-closed:
+			}
+		}()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			r.route(app, message)
+		}
+		close(closed)
+		conn.Close()
+	}
+}
+
+// ariEvent holds the fields of an ARI event used to route it.
+type ariEvent struct {
+	Type       string   `json:"type"`
+	Timestamp  string   `json:"timestamp"`
+	AsteriskID string   `json:"asterisk_id"`
+	Channel    *Channel `json:"channel"`
+}
+
+// ariTimestamp is the layout of the timestamps of ARI.
+const ariTimestamp = "2006-01-02T15:04:05.000-0700"
+
+// route hands an event read from the WebSocket of an application to the
+// dialog of the objects it is about, starting a dialog for the channels of no
+// dialog entering the application. A dialog ends when the last of its channels
+// leaves the applications.
+func (r *router) route(app string, message []byte) {
+	var e ariEvent
+	if err := json.Unmarshal(message, &e); err != nil {
+		fmt.Println(err)
+		return
+	}
+	timestamp, err := time.Parse(ariTimestamp, e.Timestamp)
+	if err != nil {
+		timestamp = time.Now()
+	}
+	serverID := r.config.ServerID
+	if len(serverID) == 0 {
+		serverID = e.AsteriskID
+	}
+	event, err := json.Marshal(Event{ServerID: serverID, Timestamp: timestamp, Type: e.Type, ARI_Body: string(message)})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	r.lock.Lock()
+	if _, running := r.apps[app]; !running {
+		// The application was stopped while the event was read.
+		r.lock.Unlock()
+		return
+	}
+	var d *dialog
+	dialogID, ok := r.registry.Route(message)
+	if ok {
+		d, ok = r.dialogs[dialogID]
+	}
+	switch {
+	case !ok && e.Type == "StasisStart" && e.Channel != nil:
+		d = r.startDialog(app, serverID)
+		r.registry.Add("channel:"+e.Channel.Id, d.id)
+		fallthrough
+	case ok && e.Type == "StasisStart":
+		d.channels++
+	case !ok:
+		r.lock.Unlock()
+		fmt.Println("Dropping event of no dialog: ", e.Type)
+		return
+	}
+	last := false
+	if e.Type == "StasisEnd" {
+		if d.channels--; d.channels == 0 {
+			delete(r.dialogs, d.id)
+			r.registry.Forget(d.id)
+			last = true
+		}
+	}
+	r.lock.Unlock()
+
+	d.publish(event, last)
+}
+
+// startDialog starts an application instance: it answers the commands of the
+// instance, publishes AppStart, and once the instance listens for events,
+// publishes those of the dialog until it ends. Must be called with the lock
+// held.
+func (r *router) startDialog(app string, serverID string) *dialog {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.config.StartTimeout))
+	d := &dialog{id: UUID(), app: app, events: make(chan []byte, 256), cancel: cancel}
+	r.dialogs[d.id] = d
+	commands, err := r.bus.StartResponder(CommandsTopic(d.id))
+	if err != nil {
+		fmt.Println(err)
+	}
+	events, err := r.bus.StartProducer(EventsTopic(d.id))
+	if err != nil {
+		fmt.Println(err)
+	}
+	appStart, ok := r.starts[app]
+	if !ok {
+		if appStart, err = r.bus.StartProducer(app); err != nil {
+			fmt.Println(err)
+		}
+		r.starts[app] = appStart
+	}
+	done := make(chan struct{})
+	if commands != nil {
+		go r.serve(d.id, commands, done)
+	}
+	go func() {
+		defer close(done)
+		defer cancel()
+		if appStart == nil || events == nil {
+			for range d.events {
+			}
+			return
+		}
+		defer close(events)
+		message, _ := json.Marshal(AppStart{Application: app, DialogID: d.id, ServerID: serverID})
+		appStart <- message
+		if !waitForTopic(ctx, r.bus, EventsTopic(d.id)) {
+			fmt.Println("No application instance for dialog: ", d.id)
+		}
+		for event := range d.events {
+			events <- event
+		}
+	}()
+	return d
+}
+
+// serve answers the commands of an application instance until done. The
+// objects the commands create are added to the dialog, so that their events
+// are routed to the instance.
+func (r *router) serve(dialogID string, commands chan *BusRequest, done chan struct{}) {
+	defer r.bus.StopResponder(commands)
+	for {
+		select {
+		case request := <-commands:
+			var cmd Command
+			if err := json.Unmarshal(request.Body, &cmd); err != nil {
+				fmt.Println(err)
+				continue
+			}
+			assignIDs(&cmd)
+			r.registry.LearnCommand(dialogID, &cmd)
+			result := r.execute(cmd)
+			r.registry.LearnResponse(dialogID, &cmd, result)
+			response, _ := json.Marshal(result)
+			if err := request.Reply(response); err != nil {
+				fmt.Println(err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// execute sends a command to ARI. Failures to reach ARI are reported as a 502
+// Bad Gateway response.
+func (r *router) execute(cmd Command) *CommandResponse {
+	response := &CommandResponse{UniqueID: cmd.UniqueID}
+	req, err := http.NewRequest(cmd.Method, strings.TrimRight(r.config.URL, "/")+cmd.URL, strings.NewReader(cmd.Body))
+	if err == nil {
+		req.SetBasicAuth(r.config.Username, r.config.Password)
+		if len(cmd.Body) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		var resp *http.Response
+		if resp, err = r.client.Do(req); err == nil {
+			defer resp.Body.Close()
+			var result []byte
+			if result, err = ioutil.ReadAll(resp.Body); err == nil {
+				response.StatusCode = resp.StatusCode
+				response.ResponseBody = string(result)
+				return response
+			}
+		}
+	}
+	message, _ := json.Marshal(map[string]string{"message": err.Error()})
+	response.StatusCode = http.StatusBadGateway
+	response.ResponseBody = string(message)
+	return response
+}
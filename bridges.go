@@ -0,0 +1,200 @@
+package ari
+
+import (
+	"sort"
+	"sync"
+)
+
+// BridgeHandle is a bridge of an application instance. It sends the commands
+// of the bridge without repeating its ID, and keeps the list of the channels
+// in the bridge up to date from the ChannelEnteredBridge, ChannelLeftBridge,
+// BridgeMerged and BridgeDestroyed events of the instance, until closed.
+//
+//	conference, err := instance.CreateBridge(ari.BridgeRequest{Type: "mixing"})
+//	conference.OnEmpty(func(b *ari.BridgeHandle) { b.Destroy() })
+//	conference.AddChannel(ari.AddChannelRequest{Channel: channelID})
+type BridgeHandle struct {
+	app       *AppInstance
+	id        string
+	lock      sync.Mutex
+	bridge    Bridge
+	members   map[string]bool
+	destroyed bool
+	onEmpty   []func(*BridgeHandle)
+	handlers  map[string][]EventHandler
+}
+
+// bridgeMemberEvents are the events updating the members of a bridge.
+var bridgeMemberEvents = []string{"ChannelEnteredBridge", "ChannelLeftBridge", "BridgeMerged", "BridgeDestroyed"}
+
+// NewBridgeHandle creates a handle for a bridge of the application instance,
+// whose members start as the channels of the given bridge, e.g. the Bridge of
+// a BridgeCreated event or the result of BridgesCreate.
+func (a *AppInstance) NewBridgeHandle(bridge Bridge) *BridgeHandle {
+	h := &BridgeHandle{
+		app:      a,
+		id:       bridge.Id,
+		bridge:   bridge,
+		members:  make(map[string]bool),
+		handlers: make(map[string][]EventHandler),
+	}
+	for _, channel := range bridge.Channels {
+		h.members[channel] = true
+	}
+	a.watch(h.object(), h, bridgeMemberEvents...)
+	return h
+}
+
+// CreateBridge creates a bridge and returns a handle for it.
+func (a *AppInstance) CreateBridge(req BridgeRequest) (*BridgeHandle, error) {
+	bridge, err := a.BridgesCreateWith(req)
+	if err != nil {
+		return nil, err
+	}
+	return a.NewBridgeHandle(*bridge), nil
+}
+
+// object returns the name of the bridge in the events of the instance.
+func (h *BridgeHandle) object() string {
+	return "bridge:" + h.id
+}
+
+// handleEvent updates the members from an event about the bridge, then calls
+// the OnEmpty handlers if the last of them left, and the handlers registered
+// for the type of the event.
+func (h *BridgeHandle) handleEvent(eventType string, v interface{}) {
+	h.lock.Lock()
+	before := len(h.members)
+	switch e := v.(type) {
+	case *ChannelEnteredBridge:
+		if e.Bridge.Id == h.id {
+			h.bridge = e.Bridge
+			h.members[e.Channel.Id] = true
+		}
+	case *ChannelLeftBridge:
+		if e.Bridge.Id == h.id {
+			h.bridge = e.Bridge
+			delete(h.members, e.Channel.Id)
+		}
+	case *BridgeMerged:
+		switch h.id {
+		case e.Bridge.Id:
+			// The channels of the other bridge moved into this one.
+			h.bridge = e.Bridge
+			h.members = make(map[string]bool)
+			for _, channel := range e.Bridge.Channels {
+				h.members[channel] = true
+			}
+		case e.Bridge_From.Id:
+			// The channels of this bridge moved into the other one.
+			h.bridge = e.Bridge_From
+			h.members = make(map[string]bool)
+		}
+	case *BridgeDestroyed:
+		if e.Bridge.Id == h.id {
+			h.bridge = e.Bridge
+			h.members = make(map[string]bool)
+			h.destroyed = true
+		}
+	}
+	var onEmpty []func(*BridgeHandle)
+	if before > 0 && len(h.members) == 0 {
+		onEmpty = h.onEmpty
+	}
+	handlers := h.handlers[eventType]
+	h.lock.Unlock()
+	for _, handler := range onEmpty {
+		handler(h)
+	}
+	for _, handler := range handlers {
+		handler(v)
+	}
+}
+
+// ID returns the ID of the bridge.
+func (h *BridgeHandle) ID() string {
+	return h.id
+}
+
+// Bridge returns the bridge as last reported by an event about it.
+func (h *BridgeHandle) Bridge() Bridge {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.bridge
+}
+
+// Members returns the IDs of the channels in the bridge, sorted.
+func (h *BridgeHandle) Members() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	members := make([]string, 0, len(h.members))
+	for channel := range h.members {
+		members = append(members, channel)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Destroyed reports whether a BridgeDestroyed event was received for the
+// bridge.
+func (h *BridgeHandle) Destroyed() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.destroyed
+}
+
+// OnEmpty registers a handler called whenever the last channel leaves the
+// bridge, including when the bridge is merged into another or destroyed. Like
+// the handlers of events, it is called on the goroutine that processes the
+// events of the instance.
+func (h *BridgeHandle) OnEmpty(handler func(*BridgeHandle)) {
+	h.lock.Lock()
+	h.onEmpty = append(h.onEmpty, handler)
+	h.lock.Unlock()
+}
+
+// On registers a handler for the events of the given type about the bridge:
+// those of the bridge, and those of the playbacks and recordings targeting it.
+func (h *BridgeHandle) On(eventType string, handler EventHandler) {
+	h.lock.Lock()
+	h.handlers[eventType] = append(h.handlers[eventType], handler)
+	h.lock.Unlock()
+	h.app.watch(h.object(), h, eventType)
+}
+
+// Close stops updating the members and calling the handlers registered with
+// OnEmpty and On. The handles of an instance need not be closed when the
+// instance ends.
+func (h *BridgeHandle) Close() {
+	h.app.unwatch(h.object(), h)
+}
+
+// AddChannel adds channels to the bridge.
+func (h *BridgeHandle) AddChannel(req AddChannelRequest) error {
+	return h.app.BridgesAddChannelWith(h.id, req)
+}
+
+// RemoveChannel removes channels from the bridge.
+func (h *BridgeHandle) RemoveChannel(channel string) error {
+	return h.app.BridgesRemoveChannel(h.id, channel)
+}
+
+// Play starts playing media to the bridge.
+func (h *BridgeHandle) Play(req PlayRequest) (*Playback, error) {
+	return h.app.BridgesPlayWith(h.id, req)
+}
+
+// Record starts recording the bridge.
+func (h *BridgeHandle) Record(req RecordRequest) (*LiveRecording, error) {
+	return h.app.BridgesRecordWith(h.id, req)
+}
+
+// StartMoh starts playing music on hold to the bridge.
+func (h *BridgeHandle) StartMoh(req MohRequest) error {
+	return h.app.BridgesStartMohWith(h.id, req)
+}
+
+// Destroy shuts the bridge down.
+func (h *BridgeHandle) Destroy() error {
+	return h.app.BridgesDestroy(h.id)
+}
@@ -0,0 +1,102 @@
+package ari
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBridgeHandleMembers(t *testing.T) {
+	a, commands := newTestInstance(t, 200, `{"id":"b1","channels":["x"]}`)
+	h, err := a.CreateBridge(BridgeRequest{Type: "mixing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-commands; cmd.URL != "/bridges" || cmd.Body != `{"type":"mixing"}` {
+		t.Errorf("Sent %s %s, want /bridges {\"type\":\"mixing\"}", cmd.URL, cmd.Body)
+	}
+	empty := 0
+	h.OnEmpty(func(*BridgeHandle) { empty++ })
+
+	tests := []struct {
+		event   Event
+		members []string
+		empty   int
+	}{
+		{Event{Type: "ChannelEnteredBridge", ARI_Body: `{"bridge":{"id":"b1"},"channel":{"id":"c1"}}`},
+			[]string{"c1", "x"}, 0},
+		{Event{Type: "ChannelEnteredBridge", ARI_Body: `{"bridge":{"id":"b2"},"channel":{"id":"c9"}}`},
+			[]string{"c1", "x"}, 0},
+		{Event{Type: "ChannelLeftBridge", ARI_Body: `{"bridge":{"id":"b1"},"channel":{"id":"x"}}`},
+			[]string{"c1"}, 0},
+		{Event{Type: "ChannelLeftBridge", ARI_Body: `{"bridge":{"id":"b1"},"channel":{"id":"c1"}}`},
+			[]string{}, 1},
+		{Event{Type: "BridgeMerged", ARI_Body: `{"bridge":{"id":"b1","channels":["c3","c4","c5"]},"bridge_from":{"id":"b3","channels":["c3","c4"]}}`},
+			[]string{"c3", "c4", "c5"}, 1},
+		{Event{Type: "BridgeMerged", ARI_Body: `{"bridge":{"id":"b4","channels":["c3","c4","c5"]},"bridge_from":{"id":"b1"}}`},
+			[]string{}, 2},
+		{Event{Type: "ChannelEnteredBridge", ARI_Body: `{"bridge":{"id":"b1"},"channel":{"id":"c6"}}`},
+			[]string{"c6"}, 2},
+		{Event{Type: "BridgeDestroyed", ARI_Body: `{"bridge":{"id":"b1"}}`},
+			[]string{}, 3},
+	}
+	for _, tt := range tests {
+		a.Dispatch(&tt.event)
+		if members := h.Members(); !reflect.DeepEqual(members, tt.members) {
+			t.Errorf("%s: members are %v, want %v", tt.event.ARI_Body, members, tt.members)
+		}
+		if empty != tt.empty {
+			t.Errorf("%s: emptied %d times, want %d", tt.event.ARI_Body, empty, tt.empty)
+		}
+	}
+	if !h.Destroyed() {
+		t.Error("Bridge not destroyed")
+	}
+}
+
+func TestBridgeHandleClose(t *testing.T) {
+	a, _ := newTestInstance(t, 200, `{}`)
+	h := a.NewBridgeHandle(Bridge{Id: "b1", Channels: []string{"c1"}})
+	var played []string
+	h.On("PlaybackStarted", func(v interface{}) { played = append(played, v.(*PlaybackStarted).Playback.Id) })
+	a.Dispatch(&Event{Type: "PlaybackStarted", ARI_Body: `{"playback":{"id":"p1","target_uri":"bridge:b1"}}`})
+	a.Dispatch(&Event{Type: "PlaybackStarted", ARI_Body: `{"playback":{"id":"p2","target_uri":"channel:c1"}}`})
+
+	h.Close()
+	a.Dispatch(&Event{Type: "PlaybackStarted", ARI_Body: `{"playback":{"id":"p3","target_uri":"bridge:b1"}}`})
+	a.Dispatch(&Event{Type: "ChannelLeftBridge", ARI_Body: `{"bridge":{"id":"b1"},"channel":{"id":"c1"}}`})
+	if !reflect.DeepEqual(played, []string{"p1"}) {
+		t.Errorf("Handled %v, want [p1]", played)
+	}
+	if members := h.Members(); !reflect.DeepEqual(members, []string{"c1"}) {
+		t.Errorf("Members are %v after Close, want [c1]", members)
+	}
+}
+
+func TestBridgeHandleCommands(t *testing.T) {
+	a, commands := newTestInstance(t, 200, `{}`)
+	h := a.NewBridgeHandle(Bridge{Id: "b1"})
+	tests := []struct {
+		call func() error
+		url  string
+		body string
+	}{
+		{func() error { return h.AddChannel(AddChannelRequest{Channel: "c1,c2", Role: "member"}) },
+			`/bridges/b1/addChannel`, `{"channel":"c1,c2","role":"member"}`},
+		{func() error { _, err := h.Play(PlayRequest{Media: "sound:beep"}); return err },
+			`/bridges/b1/play`, `{"media":"sound:beep"}`},
+		{func() error { _, err := h.Record(RecordRequest{Name: "r1", Format: "wav"}); return err },
+			`/bridges/b1/record`, `{"name":"r1","format":"wav"}`},
+		{func() error { return h.StartMoh(MohRequest{MohClass: "default"}) },
+			`/bridges/b1/moh`, `{"mohClass":"default"}`},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		cmd := <-commands
+		if cmd.URL != tt.url || cmd.Body != tt.body {
+			t.Errorf("Sent %s %s, want %s %s", cmd.URL, cmd.Body, tt.url, tt.body)
+		}
+	}
+}
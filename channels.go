@@ -0,0 +1,168 @@
+package ari
+
+import "sync"
+
+// ChannelHandle is a channel of an application instance. It sends the
+// commands of the channel without repeating its ID, and keeps a snapshot of
+// the channel up to date from the ChannelStateChange, ChannelCallerId,
+// ChannelVarset and ChannelDialplan events of the instance, until closed.
+//
+//	instance.OnStasisStart(func(e *ari.StasisStart) {
+//		channel := instance.NewChannelHandle(e.Channel)
+//		channel.Answer()
+//		channel.Play(ari.PlayRequest{Media: "sound:hello-world"})
+//	})
+type ChannelHandle struct {
+	app      *AppInstance
+	id       string
+	lock     sync.Mutex
+	channel  Channel
+	vars     map[string]string // variables set since the handle was created
+	handlers map[string][]EventHandler
+}
+
+// channelSnapshotEvents are the events updating the snapshot of a channel.
+var channelSnapshotEvents = []string{"ChannelStateChange", "ChannelCallerId", "ChannelVarset", "ChannelDialplan"}
+
+// NewChannelHandle creates a handle for a channel of the application instance,
+// whose snapshot starts as the given one, e.g. the Channel of a StasisStart
+// event or the result of ChannelsOriginate.
+func (a *AppInstance) NewChannelHandle(channel Channel) *ChannelHandle {
+	h := &ChannelHandle{
+		app:      a,
+		id:       channel.Id,
+		channel:  channel,
+		vars:     make(map[string]string),
+		handlers: make(map[string][]EventHandler),
+	}
+	a.watch(h.object(), h, channelSnapshotEvents...)
+	return h
+}
+
+// object returns the name of the channel in the events of the instance.
+func (h *ChannelHandle) object() string {
+	return "channel:" + h.id
+}
+
+// handleEvent updates the snapshot from an event about the channel, then
+// calls the handlers registered for its type.
+func (h *ChannelHandle) handleEvent(eventType string, v interface{}) {
+	h.lock.Lock()
+	switch e := v.(type) {
+	case *ChannelStateChange:
+		h.update(e.Channel)
+	case *ChannelCallerId:
+		h.update(e.Channel)
+	case *ChannelVarset:
+		if h.update(e.Channel) {
+			h.vars[e.Variable] = e.Value
+		}
+	case *ChannelDialplan:
+		h.update(e.Channel)
+	}
+	handlers := h.handlers[eventType]
+	h.lock.Unlock()
+	for _, handler := range handlers {
+		handler(v)
+	}
+}
+
+// update replaces the snapshot with the channel of an event, if it is this
+// channel. Must be called with the lock held.
+func (h *ChannelHandle) update(channel Channel) bool {
+	if channel.Id != h.id {
+		return false
+	}
+	h.channel = channel
+	return true
+}
+
+// ID returns the ID of the channel.
+func (h *ChannelHandle) ID() string {
+	return h.id
+}
+
+// Channel returns the latest snapshot of the channel.
+func (h *ChannelHandle) Channel() Channel {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.channel
+}
+
+// Var returns the value of a variable of the channel, as last set by SetVar or
+// reported by a ChannelVarset event.
+func (h *ChannelHandle) Var(name string) (string, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	value, ok := h.vars[name]
+	return value, ok
+}
+
+// Refresh replaces the snapshot with the channel as reported by ARI.
+func (h *ChannelHandle) Refresh() error {
+	channel, err := h.app.ChannelsGet(h.id)
+	if err != nil {
+		return err
+	}
+	h.lock.Lock()
+	h.update(*channel)
+	h.lock.Unlock()
+	return nil
+}
+
+// On registers a handler for the events of the given type about the channel:
+// those of the channel, and those of the playbacks and recordings targeting
+// it.
+func (h *ChannelHandle) On(eventType string, handler EventHandler) {
+	h.lock.Lock()
+	h.handlers[eventType] = append(h.handlers[eventType], handler)
+	h.lock.Unlock()
+	h.app.watch(h.object(), h, eventType)
+}
+
+// Close stops updating the snapshot and calling the handlers registered with
+// On. The handles of an instance need not be closed when the instance ends.
+func (h *ChannelHandle) Close() {
+	h.app.unwatch(h.object(), h)
+}
+
+// Answer answers the channel.
+func (h *ChannelHandle) Answer() error {
+	return h.app.ChannelsAnswer(h.id)
+}
+
+// Play starts playing media on the channel.
+func (h *ChannelHandle) Play(req PlayRequest) (*Playback, error) {
+	return h.app.ChannelsPlayWith(h.id, req)
+}
+
+// Record starts recording the channel.
+func (h *ChannelHandle) Record(req RecordRequest) (*LiveRecording, error) {
+	return h.app.ChannelsRecordWith(h.id, req)
+}
+
+// Hangup hangs up the channel.
+func (h *ChannelHandle) Hangup(req HangupRequest) error {
+	return h.app.ChannelsHangupWith(h.id, req)
+}
+
+// SetVar sets a variable of the channel.
+func (h *ChannelHandle) SetVar(name string, value string) error {
+	if err := h.app.ChannelsSetChannelVarWith(h.id, VariableRequest{Variable: name, Value: value}); err != nil {
+		return err
+	}
+	h.lock.Lock()
+	h.vars[name] = value
+	h.lock.Unlock()
+	return nil
+}
+
+// Snoop starts snooping on the channel into an application, and returns a
+// handle for the snooping channel.
+func (h *ChannelHandle) Snoop(req SnoopRequest) (*ChannelHandle, error) {
+	channel, err := h.app.ChannelsSnoopChannelWith(h.id, req)
+	if err != nil {
+		return nil, err
+	}
+	return h.app.NewChannelHandle(*channel), nil
+}
@@ -0,0 +1,86 @@
+package ari
+
+import "testing"
+
+func TestChannelHandleSnapshot(t *testing.T) {
+	a, _ := newTestInstance(t, 200, `{}`)
+	h := a.NewChannelHandle(Channel{Id: "c1", State: "Ring"})
+	a.Dispatch(&Event{Type: "ChannelStateChange", ARI_Body: `{"channel":{"id":"c1","state":"Up"}}`})
+	a.Dispatch(&Event{Type: "ChannelStateChange", ARI_Body: `{"channel":{"id":"c2","state":"Down"}}`})
+	if state := h.Channel().State; state != "Up" {
+		t.Errorf("State is %q, want Up", state)
+	}
+	a.Dispatch(&Event{Type: "ChannelVarset", ARI_Body: `{"channel":{"id":"c1","state":"Up"},"variable":"X","value":"1"}`})
+	if value, ok := h.Var("X"); !ok || value != "1" {
+		t.Errorf("X is %q, %v, want 1", value, ok)
+	}
+
+	h.Close()
+	a.Dispatch(&Event{Type: "ChannelStateChange", ARI_Body: `{"channel":{"id":"c1","state":"Down"}}`})
+	if state := h.Channel().State; state != "Up" {
+		t.Errorf("State is %q after Close, want Up", state)
+	}
+}
+
+func TestChannelHandleOn(t *testing.T) {
+	a, _ := newTestInstance(t, 200, `{}`)
+	h := a.NewChannelHandle(Channel{Id: "c1"})
+	other := a.NewChannelHandle(Channel{Id: "c2"})
+	var got []string
+	h.On("PlaybackFinished", func(v interface{}) { got = append(got, v.(*PlaybackFinished).Playback.Id) })
+	other.On("PlaybackFinished", func(v interface{}) { t.Errorf("c2 handler called with %v", v) })
+	a.Dispatch(&Event{Type: "PlaybackFinished", ARI_Body: `{"playback":{"id":"p1","target_uri":"channel:c1"}}`})
+	a.Dispatch(&Event{Type: "PlaybackFinished", ARI_Body: `{"playback":{"id":"p2","target_uri":"bridge:b1"}}`})
+	if len(got) != 1 || got[0] != "p1" {
+		t.Errorf("Handled %v, want [p1]", got)
+	}
+	if n := len(a.handlers.get("PlaybackFinished")); n != 1 {
+		t.Errorf("%d PlaybackFinished handlers on the instance, want 1", n)
+	}
+
+	h.Close()
+	a.Dispatch(&Event{Type: "PlaybackFinished", ARI_Body: `{"playback":{"id":"p3","target_uri":"channel:c1"}}`})
+	if len(got) != 1 {
+		t.Errorf("Handled %v after Close, want [p1]", got)
+	}
+}
+
+func TestChannelHandleCommands(t *testing.T) {
+	a, commands := newTestInstance(t, 200, `{"id":"s1"}`)
+	h := a.NewChannelHandle(Channel{Id: "c1"})
+	tests := []struct {
+		call func() error
+		url  string
+		body string
+	}{
+		{func() error { _, err := h.Play(PlayRequest{Media: "sound:hello-world"}); return err },
+			`/channels/c1/play`, `{"media":"sound:hello-world"}`},
+		{func() error { _, err := h.Record(RecordRequest{Name: "r1", Format: "wav"}); return err },
+			`/channels/c1/record`, `{"name":"r1","format":"wav"}`},
+		{func() error { return h.SetVar("X", "1") },
+			`/channels/c1/variable`, `{"variable":"X","value":"1"}`},
+		{func() error {
+			snoop, err := h.Snoop(SnoopRequest{App: "spy", Spy: "in"})
+			if err == nil && snoop.ID() != "s1" {
+				t.Errorf("Snoop channel is %q, want s1", snoop.ID())
+			}
+			return err
+		},
+			`/channels/c1/snoop`, `{"app":"spy","spy":"in"}`},
+		{func() error { return h.Hangup(HangupRequest{Reason: "busy"}) },
+			`/channels/c1?reason=busy`, ``},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		cmd := <-commands
+		if cmd.URL != tt.url || cmd.Body != tt.body {
+			t.Errorf("Sent %s %s, want %s %s", cmd.URL, cmd.Body, tt.url, tt.body)
+		}
+	}
+	if value, _ := h.Var("X"); value != "1" {
+		t.Errorf("X is %q, want 1", value)
+	}
+}
@@ -0,0 +1,299 @@
+package ari
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DialogRegistry maps the ARI objects of a proxy to the dialog they belong to.
+// Objects are named like the target URIs of ARI, e.g. "channel:<id>",
+// "bridge:<id>", "playback:<id>" and "recording:<name>"; snoop channels are
+// channels. The registry learns the objects from the events routed through it
+// and from the results of the commands of the dialogs, so that the events of
+// an outbound leg originated by an application instance are routed to it.
+type DialogRegistry struct {
+	lock    sync.Mutex
+	objects map[string]string // dialog IDs by object
+}
+
+// routedObject holds the fields of an ARI object used to route its events.
+type routedObject struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Target_Uri string `json:"target_uri"`
+}
+
+// routedEvent holds the objects of an ARI event used to route it.
+type routedEvent struct {
+	Type      string        `json:"type"`
+	Channel   *routedObject `json:"channel"`
+	Bridge    *routedObject `json:"bridge"`
+	From      *routedObject `json:"bridge_from"`
+	Playback  *routedObject `json:"playback"`
+	Recording *routedObject `json:"recording"`
+	Peer      *routedObject `json:"peer"`
+	Caller    *routedObject `json:"caller"`
+}
+
+// NewDialogRegistry creates an empty registry.
+func NewDialogRegistry() *DialogRegistry {
+	return &DialogRegistry{objects: make(map[string]string)}
+}
+
+// Add records that an object belongs to a dialog.
+func (r *DialogRegistry) Add(object string, dialogID string) {
+	r.lock.Lock()
+	r.objects[object] = dialogID
+	r.lock.Unlock()
+}
+
+// Remove forgets about an object.
+func (r *DialogRegistry) Remove(object string) {
+	r.lock.Lock()
+	delete(r.objects, object)
+	r.lock.Unlock()
+}
+
+// Lookup returns the dialog an object belongs to.
+func (r *DialogRegistry) Lookup(object string) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	dialogID, ok := r.objects[object]
+	return dialogID, ok
+}
+
+// Forget forgets about the objects of a dialog which ended.
+func (r *DialogRegistry) Forget(dialogID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for object, d := range r.objects {
+		if d == dialogID {
+			delete(r.objects, object)
+		}
+	}
+}
+
+// objects returns the objects of an event, the one it is about first.
+func (e *routedEvent) objects() []string {
+	var objects []string
+	add := func(kind string, id string) {
+		if len(id) > 0 {
+			objects = append(objects, kind+":"+id)
+		}
+	}
+	if e.Channel != nil {
+		add("channel", e.Channel.Id)
+	}
+	if e.Bridge != nil {
+		add("bridge", e.Bridge.Id)
+	}
+	if e.From != nil {
+		add("bridge", e.From.Id)
+	}
+	if e.Playback != nil {
+		add("playback", e.Playback.Id)
+		if len(e.Playback.Target_Uri) > 0 {
+			objects = append(objects, e.Playback.Target_Uri)
+		}
+	}
+	if e.Recording != nil {
+		add("recording", e.Recording.Name)
+		if len(e.Recording.Target_Uri) > 0 {
+			objects = append(objects, e.Recording.Target_Uri)
+		}
+	}
+	if e.Peer != nil {
+		add("channel", e.Peer.Id)
+	}
+	if e.Caller != nil {
+		add("channel", e.Caller.Id)
+	}
+	return objects
+}
+
+// ended returns the object an event reports the end of, if any.
+func (e *routedEvent) ended() string {
+	switch {
+	case (e.Type == "StasisEnd" || e.Type == "ChannelDestroyed") && e.Channel != nil:
+		return "channel:" + e.Channel.Id
+	case e.Type == "BridgeDestroyed" && e.Bridge != nil:
+		return "bridge:" + e.Bridge.Id
+	case e.Type == "BridgeMerged" && e.From != nil:
+		return "bridge:" + e.From.Id
+	case e.Type == "PlaybackFinished" && e.Playback != nil:
+		return "playback:" + e.Playback.Id
+	case (e.Type == "RecordingFinished" || e.Type == "RecordingFailed") && e.Recording != nil:
+		return "recording:" + e.Recording.Name
+	}
+	return ""
+}
+
+// Route returns the dialog of an ARI event: the dialog of the first of its
+// objects known to the registry. The other objects of the event, such as the
+// bridge a channel entered or the playback started on a channel, are added to
+// the dialog, and the object whose end the event reports is removed.
+func (r *DialogRegistry) Route(message []byte) (string, bool) {
+	var e routedEvent
+	if err := json.Unmarshal(message, &e); err != nil {
+		return "", false
+	}
+	objects := e.objects()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var dialogID string
+	for _, object := range objects {
+		if d, ok := r.objects[object]; ok {
+			dialogID = d
+			break
+		}
+	}
+	if len(dialogID) == 0 {
+		return "", false
+	}
+	for _, object := range objects {
+		if _, ok := r.objects[object]; !ok {
+			r.objects[object] = dialogID
+		}
+	}
+	if ended := e.ended(); len(ended) > 0 {
+		delete(r.objects, ended)
+	}
+	return dialogID, true
+}
+
+// commandPath splits the path of the URL of a command into its segments.
+func commandPath(cmd *Command) []string {
+	u, err := url.Parse(cmd.URL)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.Trim(u.Path, "/"), "/")
+}
+
+// createParams holds the parameters of a command naming the objects it
+// creates.
+type createParams struct {
+	ChannelId      string `json:"channelId"`
+	OtherChannelId string `json:"otherChannelId"`
+	BridgeId       string `json:"bridgeId"`
+	SnoopId        string `json:"snoopId"`
+	PlaybackId     string `json:"playbackId"`
+	Name           string `json:"name"`
+}
+
+// LearnCommand adds to a dialog the objects a command is about to create with
+// IDs chosen by the application instance, e.g. by POST /bridges/{bridgeId},
+// before it is executed, so that their first events are routed to the dialog.
+func (r *DialogRegistry) LearnCommand(dialogID string, cmd *Command) {
+	if cmd.Method != "POST" {
+		return
+	}
+	var params createParams
+	json.Unmarshal([]byte(cmd.Body), &params)
+	add := func(kind string, id string) {
+		if len(id) > 0 {
+			r.Add(kind+":"+id, dialogID)
+		}
+	}
+	path := commandPath(cmd)
+	switch {
+	case len(path) == 1 && path[0] == "channels", len(path) == 2 && path[1] == "create":
+		add("channel", params.ChannelId)
+		add("channel", params.OtherChannelId)
+	case len(path) == 2 && path[0] == "channels":
+		add("channel", path[1])
+		add("channel", params.OtherChannelId)
+	case len(path) == 1 && path[0] == "bridges":
+		add("bridge", params.BridgeId)
+	case len(path) == 2 && path[0] == "bridges":
+		add("bridge", path[1])
+	case len(path) >= 3 && path[2] == "snoop":
+		add("channel", params.SnoopId)
+		if len(path) == 4 {
+			add("channel", path[3])
+		}
+	case len(path) >= 3 && path[2] == "play":
+		add("playback", params.PlaybackId)
+		if len(path) == 4 {
+			add("playback", path[3])
+		}
+	case len(path) == 3 && path[2] == "record":
+		add("recording", params.Name)
+	}
+}
+
+// assignIDs chooses the IDs of the objects a command creates which the
+// application instance left to ARI, e.g. the channels of POST /channels, so
+// that LearnCommand adds them to the dialog before their first events.
+func assignIDs(cmd *Command) {
+	if cmd.Method != "POST" {
+		return
+	}
+	var names []string
+	path := commandPath(cmd)
+	switch {
+	case len(path) == 1 && path[0] == "channels", len(path) == 2 && path[0] == "channels" && path[1] == "create":
+		names = []string{"channelId", "otherChannelId"}
+	case len(path) == 2 && path[0] == "channels":
+		names = []string{"otherChannelId"}
+	case len(path) == 1 && path[0] == "bridges":
+		names = []string{"bridgeId"}
+	case len(path) == 3 && path[2] == "snoop":
+		names = []string{"snoopId"}
+	case len(path) == 3 && path[2] == "play":
+		names = []string{"playbackId"}
+	default:
+		return
+	}
+	params := make(map[string]interface{})
+	if len(cmd.Body) > 0 && json.Unmarshal([]byte(cmd.Body), &params) != nil {
+		return
+	}
+	for _, name := range names {
+		if id, _ := params[name].(string); len(id) == 0 {
+			params[name] = UUID()
+		}
+	}
+	body, _ := json.Marshal(params)
+	cmd.Body = string(body)
+}
+
+// LearnResponse adds to a dialog the object created by a successful command,
+// such as the channel of an origination or snoop, a bridge, a playback or a
+// live recording.
+func (r *DialogRegistry) LearnResponse(dialogID string, cmd *Command, response *CommandResponse) {
+	if cmd.Method != "POST" || response.StatusCode < 200 || response.StatusCode > 299 {
+		return
+	}
+	var created routedObject
+	if json.Unmarshal([]byte(response.ResponseBody), &created) != nil {
+		return
+	}
+	path := commandPath(cmd)
+	if len(path) == 0 {
+		return
+	}
+	var kind string
+	switch {
+	case len(path) <= 2 && path[0] == "channels":
+		kind = "channel"
+	case len(path) >= 3 && path[0] == "channels" && path[2] == "snoop":
+		kind = "channel"
+	case len(path) <= 2 && path[0] == "bridges":
+		kind = "bridge"
+	case len(path) >= 3 && path[2] == "play":
+		kind = "playback"
+	case len(path) == 3 && path[2] == "record":
+		if len(created.Name) > 0 {
+			r.Add("recording:"+created.Name, dialogID)
+		}
+		return
+	default:
+		return
+	}
+	if len(created.Id) > 0 {
+		r.Add(kind+":"+created.Id, dialogID)
+	}
+}
@@ -0,0 +1,92 @@
+package ari
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Error is returned by the commands of an AppInstance when ARI answers with a
+// status code outside of the 2xx range.
+type Error struct {
+	StatusCode   int    // HTTP status code returned by ARI.
+	Method       string // HTTP method of the command.
+	URL          string // URL of the command.
+	ResponseBody string // Raw body of the response.
+	Message      string // Error message from ARI, or a description of the status code.
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// responseError returns nil when the response to a command has a 2xx status
+// code, and an *Error describing it otherwise. The message of the error is the
+// one ARI put in the response body; failing that, the description that
+// descriptions holds for the status code; failing that, the HTTP status text.
+func responseError(result *CommandResponse, method string, url string, descriptions map[int]string) error {
+	if result.StatusCode >= 200 && result.StatusCode < 300 {
+		return nil
+	}
+	e := &Error{
+		StatusCode:   result.StatusCode,
+		Method:       method,
+		URL:          url,
+		ResponseBody: result.ResponseBody,
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal([]byte(result.ResponseBody), &body) == nil && len(body.Message) > 0 {
+		e.Message = body.Message
+	} else if description, ok := descriptions[result.StatusCode]; ok {
+		e.Message = description
+	} else {
+		e.Message = http.StatusText(result.StatusCode)
+	}
+	return e
+}
+
+// StatusCode returns the HTTP status code carried by err, or 0 when err is not
+// an *Error.
+func StatusCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsBadRequest reports whether err is an *Error for a 400 response, typically
+// an invalid or missing parameter.
+func IsBadRequest(err error) bool {
+	return StatusCode(err) == http.StatusBadRequest
+}
+
+// IsUnauthorized reports whether err is an *Error for a 401 response.
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsNotFound reports whether err is an *Error for a 404 response, i.e. the
+// channel, bridge, playback or other resource does not exist.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict reports whether err is an *Error for a 409 response, typically a
+// resource not in a Stasis application or in the wrong state.
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsUnprocessableEntity reports whether err is an *Error for a 422 response,
+// i.e. a resource referenced in the request body does not exist.
+func IsUnprocessableEntity(err error) bool {
+	return StatusCode(err) == http.StatusUnprocessableEntity
+}
+
+// IsServerError reports whether err is an *Error for a 5xx response.
+func IsServerError(err error) bool {
+	code := StatusCode(err)
+	return code >= 500 && code < 600
+}
@@ -0,0 +1,64 @@
+package ari
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResponseError(t *testing.T) {
+	descriptions := map[int]string{404: "Channel not found", 409: "Channel not in a Stasis application"}
+	tests := []struct {
+		status   int
+		body     string
+		message  string
+		notFound bool
+		conflict bool
+		server   bool
+	}{
+		{404, `{"message":"Channel c1 not found"}`, "Channel c1 not found", true, false, false},
+		{404, ``, "Channel not found", true, false, false},
+		{409, `{"message":""}`, "Channel not in a Stasis application", false, true, false},
+		{409, `not json`, "Channel not in a Stasis application", false, true, false},
+		{500, ``, "Internal Server Error", false, false, true},
+		{503, `{"message":"Asterisk shutting down"}`, "Asterisk shutting down", false, false, true},
+		{401, ``, "Unauthorized", false, false, false},
+	}
+	for _, tt := range tests {
+		err := responseError(&CommandResponse{StatusCode: tt.status, ResponseBody: tt.body}, "POST", "/channels/c1/answer", descriptions)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%d %s: got %v, want an *Error", tt.status, tt.body, err)
+			continue
+		}
+		if e.Message != tt.message || e.ResponseBody != tt.body || e.Method != "POST" || e.URL != "/channels/c1/answer" {
+			t.Errorf("%d %s: got %+v, want the message %q", tt.status, tt.body, e, tt.message)
+		}
+		if StatusCode(err) != tt.status {
+			t.Errorf("%d %s: StatusCode is %d", tt.status, tt.body, StatusCode(err))
+		}
+		if IsNotFound(err) != tt.notFound || IsConflict(err) != tt.conflict || IsServerError(err) != tt.server {
+			t.Errorf("%d %s: IsNotFound %v, IsConflict %v, IsServerError %v", tt.status, tt.body, IsNotFound(err), IsConflict(err), IsServerError(err))
+		}
+	}
+
+	for _, status := range []int{200, 204} {
+		if err := responseError(&CommandResponse{StatusCode: status}, "POST", "/channels/c1/answer", descriptions); err != nil {
+			t.Errorf("%d: got %v, want nil", status, err)
+		}
+	}
+	other := errors.New("Command timed out")
+	if StatusCode(other) != 0 || IsNotFound(other) || IsServerError(other) {
+		t.Error("Error of another type classified as an ARI error")
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	a, _ := newTestInstance(t, 404, `{"message":"Channel c1 not found"}`)
+	err := a.ChannelsAnswer("c1")
+	if !IsNotFound(err) {
+		t.Fatalf("got %v, want a 404 *Error", err)
+	}
+	if want := "POST /channels/c1/answer: 404 Channel c1 not found"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,287 @@
+package ari
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// eventTypes maps the name of every ARI event to a constructor for the struct
+// its body is decoded into.
+var eventTypes = map[string]func() interface{}{
+	"ApplicationReplaced":    func() interface{} { return new(ApplicationReplaced) },
+	"BridgeAttendedTransfer": func() interface{} { return new(BridgeAttendedTransfer) },
+	"BridgeBlindTransfer":    func() interface{} { return new(BridgeBlindTransfer) },
+	"BridgeCreated":          func() interface{} { return new(BridgeCreated) },
+	"BridgeDestroyed":        func() interface{} { return new(BridgeDestroyed) },
+	"BridgeMerged":           func() interface{} { return new(BridgeMerged) },
+	"ChannelCallerId":        func() interface{} { return new(ChannelCallerId) },
+	"ChannelCreated":         func() interface{} { return new(ChannelCreated) },
+	"ChannelDestroyed":       func() interface{} { return new(ChannelDestroyed) },
+	"ChannelDialplan":        func() interface{} { return new(ChannelDialplan) },
+	"ChannelDtmfReceived":    func() interface{} { return new(ChannelDtmfReceived) },
+	"ChannelEnteredBridge":   func() interface{} { return new(ChannelEnteredBridge) },
+	"ChannelHangupRequest":   func() interface{} { return new(ChannelHangupRequest) },
+	"ChannelLeftBridge":      func() interface{} { return new(ChannelLeftBridge) },
+	"ChannelStateChange":     func() interface{} { return new(ChannelStateChange) },
+	"ChannelTalkingFinished": func() interface{} { return new(ChannelTalkingFinished) },
+	"ChannelTalkingStarted":  func() interface{} { return new(ChannelTalkingStarted) },
+	"ChannelUserevent":       func() interface{} { return new(ChannelUserevent) },
+	"ChannelVarset":          func() interface{} { return new(ChannelVarset) },
+	"DeviceStateChanged":     func() interface{} { return new(DeviceStateChanged) },
+	"Dial":                   func() interface{} { return new(Dial) },
+	"EndpointStateChange":    func() interface{} { return new(EndpointStateChange) },
+	"MissingParams":          func() interface{} { return new(MissingParams) },
+	"PlaybackFinished":       func() interface{} { return new(PlaybackFinished) },
+	"PlaybackStarted":        func() interface{} { return new(PlaybackStarted) },
+	"RecordingFailed":        func() interface{} { return new(RecordingFailed) },
+	"RecordingFinished":      func() interface{} { return new(RecordingFinished) },
+	"RecordingStarted":       func() interface{} { return new(RecordingStarted) },
+	"StasisEnd":              func() interface{} { return new(StasisEnd) },
+	"StasisStart":            func() interface{} { return new(StasisStart) },
+	"TextMessageReceived":    func() interface{} { return new(TextMessageReceived) },
+}
+
+// UnknownEvent is returned by DecodeEvent for events of a type this library
+// does not know about. Body holds the raw ARI payload.
+type UnknownEvent struct {
+	Type string
+	Body string
+}
+
+// DecodeEvent unmarshals the ARI_Body of an Event into the struct matching its
+// Type, e.g. *StasisStart for a "StasisStart" event. Events of an unknown type
+// are returned as *UnknownEvent.
+func DecodeEvent(e *Event) (interface{}, error) {
+	newEvent, ok := eventTypes[e.Type]
+	if !ok {
+		return &UnknownEvent{Type: e.Type, Body: e.ARI_Body}, nil
+	}
+	v := newEvent()
+	if err := json.Unmarshal([]byte(e.ARI_Body), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Decode is a convenience wrapper around DecodeEvent.
+func (e *Event) Decode() (interface{}, error) {
+	return DecodeEvent(e)
+}
+
+// EventHandler is called with the decoded body of an event, e.g. *StasisStart.
+type EventHandler func(interface{})
+
+// eventHandlers is the registry of handlers of an application instance, keyed
+// by event type.
+type eventHandlers struct {
+	sync.Mutex
+	handlers map[string][]EventHandler
+}
+
+// add registers a handler for the given event type.
+func (h *eventHandlers) add(eventType string, handler EventHandler) {
+	h.Lock()
+	h.handlers[eventType] = append(h.handlers[eventType], handler)
+	h.Unlock()
+}
+
+// get returns the handlers registered for the given event type.
+func (h *eventHandlers) get(eventType string) []EventHandler {
+	h.Lock()
+	defer h.Unlock()
+	return h.handlers[eventType]
+}
+
+// On registers a handler to be called with the decoded body of every event of
+// the given type received by the application instance. Handlers are called in
+// the order they were registered, once the event has been read from Events, on
+// the goroutine that processes the events of the instance; a handler must
+// therefore not wait for another event itself.
+func (a *AppInstance) On(eventType string, handler EventHandler) {
+	a.handlers.add(eventType, handler)
+}
+
+// Dispatch decodes an event and calls the handlers registered for its type.
+func (a *AppInstance) Dispatch(e *Event) error {
+	handlers := a.handlers.get(e.Type)
+	if len(handlers) == 0 {
+		return nil
+	}
+	v, err := DecodeEvent(e)
+	if err != nil {
+		return err
+	}
+	for _, handler := range handlers {
+		handler(v)
+	}
+	return nil
+}
+
+// Run reads and discards the events of the application instance, leaving their
+// processing to the registered handlers. Returns when the Events channel is
+// closed.
+func (a *AppInstance) Run() {
+	for range a.Events {
+	}
+}
+
+// OnApplicationReplaced registers a handler for ApplicationReplaced events.
+func (a *AppInstance) OnApplicationReplaced(handler func(*ApplicationReplaced)) {
+	a.On("ApplicationReplaced", func(v interface{}) { handler(v.(*ApplicationReplaced)) })
+}
+
+// OnBridgeAttendedTransfer registers a handler for BridgeAttendedTransfer events.
+func (a *AppInstance) OnBridgeAttendedTransfer(handler func(*BridgeAttendedTransfer)) {
+	a.On("BridgeAttendedTransfer", func(v interface{}) { handler(v.(*BridgeAttendedTransfer)) })
+}
+
+// OnBridgeBlindTransfer registers a handler for BridgeBlindTransfer events.
+func (a *AppInstance) OnBridgeBlindTransfer(handler func(*BridgeBlindTransfer)) {
+	a.On("BridgeBlindTransfer", func(v interface{}) { handler(v.(*BridgeBlindTransfer)) })
+}
+
+// OnBridgeCreated registers a handler for BridgeCreated events.
+func (a *AppInstance) OnBridgeCreated(handler func(*BridgeCreated)) {
+	a.On("BridgeCreated", func(v interface{}) { handler(v.(*BridgeCreated)) })
+}
+
+// OnBridgeDestroyed registers a handler for BridgeDestroyed events.
+func (a *AppInstance) OnBridgeDestroyed(handler func(*BridgeDestroyed)) {
+	a.On("BridgeDestroyed", func(v interface{}) { handler(v.(*BridgeDestroyed)) })
+}
+
+// OnBridgeMerged registers a handler for BridgeMerged events.
+func (a *AppInstance) OnBridgeMerged(handler func(*BridgeMerged)) {
+	a.On("BridgeMerged", func(v interface{}) { handler(v.(*BridgeMerged)) })
+}
+
+// OnChannelCallerId registers a handler for ChannelCallerId events.
+func (a *AppInstance) OnChannelCallerId(handler func(*ChannelCallerId)) {
+	a.On("ChannelCallerId", func(v interface{}) { handler(v.(*ChannelCallerId)) })
+}
+
+// OnChannelCreated registers a handler for ChannelCreated events.
+func (a *AppInstance) OnChannelCreated(handler func(*ChannelCreated)) {
+	a.On("ChannelCreated", func(v interface{}) { handler(v.(*ChannelCreated)) })
+}
+
+// OnChannelDestroyed registers a handler for ChannelDestroyed events.
+func (a *AppInstance) OnChannelDestroyed(handler func(*ChannelDestroyed)) {
+	a.On("ChannelDestroyed", func(v interface{}) { handler(v.(*ChannelDestroyed)) })
+}
+
+// OnChannelDialplan registers a handler for ChannelDialplan events.
+func (a *AppInstance) OnChannelDialplan(handler func(*ChannelDialplan)) {
+	a.On("ChannelDialplan", func(v interface{}) { handler(v.(*ChannelDialplan)) })
+}
+
+// OnChannelDtmfReceived registers a handler for ChannelDtmfReceived events.
+func (a *AppInstance) OnChannelDtmfReceived(handler func(*ChannelDtmfReceived)) {
+	a.On("ChannelDtmfReceived", func(v interface{}) { handler(v.(*ChannelDtmfReceived)) })
+}
+
+// OnDTMF registers a handler for ChannelDtmfReceived events. It is a shorter
+// name for OnChannelDtmfReceived.
+func (a *AppInstance) OnDTMF(handler func(*ChannelDtmfReceived)) {
+	a.OnChannelDtmfReceived(handler)
+}
+
+// OnChannelEnteredBridge registers a handler for ChannelEnteredBridge events.
+func (a *AppInstance) OnChannelEnteredBridge(handler func(*ChannelEnteredBridge)) {
+	a.On("ChannelEnteredBridge", func(v interface{}) { handler(v.(*ChannelEnteredBridge)) })
+}
+
+// OnChannelHangupRequest registers a handler for ChannelHangupRequest events.
+func (a *AppInstance) OnChannelHangupRequest(handler func(*ChannelHangupRequest)) {
+	a.On("ChannelHangupRequest", func(v interface{}) { handler(v.(*ChannelHangupRequest)) })
+}
+
+// OnChannelLeftBridge registers a handler for ChannelLeftBridge events.
+func (a *AppInstance) OnChannelLeftBridge(handler func(*ChannelLeftBridge)) {
+	a.On("ChannelLeftBridge", func(v interface{}) { handler(v.(*ChannelLeftBridge)) })
+}
+
+// OnChannelStateChange registers a handler for ChannelStateChange events.
+func (a *AppInstance) OnChannelStateChange(handler func(*ChannelStateChange)) {
+	a.On("ChannelStateChange", func(v interface{}) { handler(v.(*ChannelStateChange)) })
+}
+
+// OnChannelTalkingFinished registers a handler for ChannelTalkingFinished events.
+func (a *AppInstance) OnChannelTalkingFinished(handler func(*ChannelTalkingFinished)) {
+	a.On("ChannelTalkingFinished", func(v interface{}) { handler(v.(*ChannelTalkingFinished)) })
+}
+
+// OnChannelTalkingStarted registers a handler for ChannelTalkingStarted events.
+func (a *AppInstance) OnChannelTalkingStarted(handler func(*ChannelTalkingStarted)) {
+	a.On("ChannelTalkingStarted", func(v interface{}) { handler(v.(*ChannelTalkingStarted)) })
+}
+
+// OnChannelUserevent registers a handler for ChannelUserevent events.
+func (a *AppInstance) OnChannelUserevent(handler func(*ChannelUserevent)) {
+	a.On("ChannelUserevent", func(v interface{}) { handler(v.(*ChannelUserevent)) })
+}
+
+// OnChannelVarset registers a handler for ChannelVarset events.
+func (a *AppInstance) OnChannelVarset(handler func(*ChannelVarset)) {
+	a.On("ChannelVarset", func(v interface{}) { handler(v.(*ChannelVarset)) })
+}
+
+// OnDeviceStateChanged registers a handler for DeviceStateChanged events.
+func (a *AppInstance) OnDeviceStateChanged(handler func(*DeviceStateChanged)) {
+	a.On("DeviceStateChanged", func(v interface{}) { handler(v.(*DeviceStateChanged)) })
+}
+
+// OnDial registers a handler for Dial events.
+func (a *AppInstance) OnDial(handler func(*Dial)) {
+	a.On("Dial", func(v interface{}) { handler(v.(*Dial)) })
+}
+
+// OnEndpointStateChange registers a handler for EndpointStateChange events.
+func (a *AppInstance) OnEndpointStateChange(handler func(*EndpointStateChange)) {
+	a.On("EndpointStateChange", func(v interface{}) { handler(v.(*EndpointStateChange)) })
+}
+
+// OnMissingParams registers a handler for MissingParams events.
+func (a *AppInstance) OnMissingParams(handler func(*MissingParams)) {
+	a.On("MissingParams", func(v interface{}) { handler(v.(*MissingParams)) })
+}
+
+// OnPlaybackFinished registers a handler for PlaybackFinished events.
+func (a *AppInstance) OnPlaybackFinished(handler func(*PlaybackFinished)) {
+	a.On("PlaybackFinished", func(v interface{}) { handler(v.(*PlaybackFinished)) })
+}
+
+// OnPlaybackStarted registers a handler for PlaybackStarted events.
+func (a *AppInstance) OnPlaybackStarted(handler func(*PlaybackStarted)) {
+	a.On("PlaybackStarted", func(v interface{}) { handler(v.(*PlaybackStarted)) })
+}
+
+// OnRecordingFailed registers a handler for RecordingFailed events.
+func (a *AppInstance) OnRecordingFailed(handler func(*RecordingFailed)) {
+	a.On("RecordingFailed", func(v interface{}) { handler(v.(*RecordingFailed)) })
+}
+
+// OnRecordingFinished registers a handler for RecordingFinished events.
+func (a *AppInstance) OnRecordingFinished(handler func(*RecordingFinished)) {
+	a.On("RecordingFinished", func(v interface{}) { handler(v.(*RecordingFinished)) })
+}
+
+// OnRecordingStarted registers a handler for RecordingStarted events.
+func (a *AppInstance) OnRecordingStarted(handler func(*RecordingStarted)) {
+	a.On("RecordingStarted", func(v interface{}) { handler(v.(*RecordingStarted)) })
+}
+
+// OnStasisEnd registers a handler for StasisEnd events.
+func (a *AppInstance) OnStasisEnd(handler func(*StasisEnd)) {
+	a.On("StasisEnd", func(v interface{}) { handler(v.(*StasisEnd)) })
+}
+
+// OnStasisStart registers a handler for StasisStart events.
+func (a *AppInstance) OnStasisStart(handler func(*StasisStart)) {
+	a.On("StasisStart", func(v interface{}) { handler(v.(*StasisStart)) })
+}
+
+// OnTextMessageReceived registers a handler for TextMessageReceived events.
+func (a *AppInstance) OnTextMessageReceived(handler func(*TextMessageReceived)) {
+	a.On("TextMessageReceived", func(v interface{}) { handler(v.(*TextMessageReceived)) })
+}
@@ -1,24 +1,99 @@
 package ari
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
-// global variables
-var bus MessageBus // global var that holds the current MessageBus interface.
+// DefaultClient is the Client used by the package level functions, such as
+// InitProducer and NewApp. Its message bus is the one set up by InitBus.
+var DefaultClient = &Client{}
+
+// DefaultCommandTimeout is how long a command waits for its response unless
+// SetCommandTimeout is called on the application instance.
+const DefaultCommandTimeout = 5 * time.Second
+
+// ErrCommandTimeout is returned by the commands of an AppInstance when no
+// response arrived within the command timeout or the deadline of the context.
+var ErrCommandTimeout = errors.New("Command timed out waiting for a response.")
+
+// ErrInstanceClosed is returned by the commands of an AppInstance once it has
+// been closed.
+var ErrInstanceClosed = errors.New("Application instance is closed.")
 
 // MessageBus interface contains methods for interacting with the abstracted message bus.
+// A producer is stopped by closing its channel. A consumer is stopped with
+// StopConsumer, after which no more messages are sent on its channel; the
+// channel itself is not closed.
+// Request publishes a request on a topic and waits for the reply of one of its
+// responders, or for ctx to be done. Responders are started with
+// StartResponder, receive the requests on its channel and answer them with
+// Reply; they are stopped with StopResponder, like consumers.
 type MessageBus interface {
 	InitBus(config interface{}) error
 	StartProducer(topic string) (chan []byte, error)
 	StartConsumer(topic string) (chan []byte, error)
+	StopConsumer(consumer chan []byte) error
 	TopicExists(topic string) bool
+	Request(ctx context.Context, topic string, request []byte) ([]byte, error)
+	StartResponder(topic string) (chan *BusRequest, error)
+	StopResponder(responder chan *BusRequest) error
+}
+
+// BusRequest is a request received by a responder of a message bus.
+type BusRequest struct {
+	Body  []byte
+	reply func(response []byte) error
+}
+
+// NewBusRequest creates a request answered by the reply function, for use by
+// MessageBus implementations.
+func NewBusRequest(body []byte, reply func(response []byte) error) *BusRequest {
+	return &BusRequest{Body: body, reply: reply}
+}
+
+// Reply sends the response to the request back to its requester.
+func (r *BusRequest) Reply(response []byte) error {
+	return r.reply(response)
+}
+
+// ConnectionState is a change in the state of the connection of a message bus
+// to its broker, reported to the OnStateChange callback of the configuration of
+// the bus.
+type ConnectionState int
+
+const (
+	Disconnected     ConnectionState = iota // The connection was lost; the bus is reconnecting.
+	Reconnected                             // The connection was restored, along with producers and consumers.
+	ConnectionClosed                        // The bus gave up reconnecting, or was closed.
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Disconnected:
+		return "Disconnected"
+	case Reconnected:
+		return "Reconnected"
+	case ConnectionClosed:
+		return "ConnectionClosed"
+	}
+	return "Unknown"
+}
+
+// Client owns a connection to a message bus. Applications, application
+// instances, producers and consumers created from a Client use its bus, which
+// allows a process to talk to several brokers.
+type Client struct {
+	bus MessageBus
 }
 
 // AppInstanceHandler when you start a new App, you pass in a function of type AppInstanceHandler.
@@ -28,18 +103,29 @@ type AppInstanceHandler func(*AppInstance)
 // App struct contains information about an ARI application.
 // The top level that signals the application instance creation.
 type App struct {
-	name   string
-	Events chan []byte
-	Stop   chan bool
+	name      string
+	client    *Client
+	Events    chan []byte
+	Stop      chan bool // Stops the application when sent to, like Shutdown.
+	done      chan struct{}
+	stopOnce  sync.Once
+	lock      sync.Mutex
+	instances map[*AppInstance]bool
+	running   sync.WaitGroup // AppInstanceHandler goroutines
 }
 
 // AppInstance struct contains the channels necessary for communication to/from
 // the various message bus topics and the event channel.
 type AppInstance struct {
-	commandChannel  chan []byte
-	responseChannel chan *CommandResponse
-	quit            chan int
-	Events          chan *Event
+	client       *Client
+	commandTopic string
+	handlers     *eventHandlers
+	objects      *objectEvents
+	state        *instanceState
+	ctx          context.Context
+	timeout      time.Duration
+	quit         chan int
+	Events       chan *Event
 }
 
 // Event struct contains the events we pull off the websocket connection.
@@ -72,6 +158,32 @@ type CommandResponse struct {
 	ResponseBody string `json:"response_body"`
 }
 
+// CommandsTopic returns the topic on which an application instance sends its
+// commands to the proxy.
+func CommandsTopic(dialogID string) string {
+	return strings.Join([]string{"commands", dialogID}, "_")
+}
+
+// EventsTopic returns the topic on which the proxy sends the events of a
+// dialog to its application instance.
+func EventsTopic(dialogID string) string {
+	return strings.Join([]string{"events", dialogID}, "_")
+}
+
+// splitInstanceTopic splits a topic of an application instance into its kind
+// and dialog ID.
+func splitInstanceTopic(topic string) (kind string, dialogID string, ok bool) {
+	parts := strings.SplitN(topic, "_", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	switch parts[0] {
+	case "commands", "events":
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
 // InitLogger is a wrapper function to provide a sane interface to logging messages.
 func InitLogger(handle io.Writer, prefix string) *log.Logger {
 	return log.New(handle, strings.Join([]string{prefix, ": "}, ""), log.Ldate|log.Ltime|log.Lshortfile)
@@ -88,66 +200,214 @@ func UUID() string {
 	return uuid
 }
 
-// InitBus will initialize a new message bus.
+// BusFactory creates a message bus, which is then initialized with InitBus.
+type BusFactory func() MessageBus
+
+// busFactories holds the message bus backends by name.
+var busFactories = struct {
+	sync.Mutex
+	factories map[string]BusFactory
+}{factories: make(map[string]BusFactory)}
+
+func init() {
+	RegisterBus("NATS", func() MessageBus { return new(NATS) })
+	RegisterBus("RABBITMQ", func() MessageBus { return new(RabbitMQ) })
+	RegisterBus("MEMORY", func() MessageBus { return new(Memory) })
+	RegisterBus("KAFKA", func() MessageBus { return new(Kafka) })
+	RegisterBus("REDIS", func() MessageBus { return new(Redis) })
+	RegisterBus("OSLO", func() MessageBus { return new(OSLO) })
+	RegisterBus("ASTERISK", func() MessageBus { return new(Asterisk) })
+}
+
+// RegisterBus makes a message bus backend available under the given name to
+// NewClient and InitBus. Registering a name twice replaces the backend.
+func RegisterBus(name string, factory BusFactory) {
+	busFactories.Lock()
+	busFactories.factories[name] = factory
+	busFactories.Unlock()
+}
+
+// NewClient initializes a new message bus and returns a client using it.
 // Abstracts the message bus initialization based on the configuration in order
 // to allow the creation of a proxy or client using message bus agnostic
-// methods.
+// methods. The configuration is the config struct of the backend, e.g.
+// NATSConfig, or a map holding its fields.
+func NewClient(busType string, config interface{}) (*Client, error) {
+	busFactories.Lock()
+	factory, ok := busFactories.factories[busType]
+	busFactories.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown message bus type: %s", busType)
+	}
+	bus := factory()
+	if err := bus.InitBus(config); err != nil {
+		return nil, err
+	}
+	return &Client{bus: bus}, nil
+}
+
+// Duration is a time.Duration in the configuration of a message bus. In a map
+// configuration it is given either as a string parsed by time.ParseDuration,
+// such as "1.5s" or "250ms", or as a number of nanoseconds.
+type Duration time.Duration
+
+// UnmarshalJSON decodes a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("Invalid duration: %s", s)
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var v int64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("Invalid duration: %s", data)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON encodes the duration as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// decodeConfig fills the config struct of a message bus from the configuration
+// given to InitBus: the struct itself, a pointer to it, or a map holding its
+// fields by their JSON names.
+func decodeConfig(config interface{}, target interface{}) error {
+	if config == nil {
+		return nil
+	}
+	// Structs are copied as is, to keep the fields which cannot be encoded,
+	// such as callbacks.
+	value, t := reflect.ValueOf(config), reflect.ValueOf(target).Elem()
+	if value.Type() == t.Type() {
+		t.Set(value)
+		return nil
+	}
+	if value.Kind() == reflect.Ptr && value.Type().Elem() == t.Type() {
+		if !value.IsNil() {
+			t.Set(value.Elem())
+		}
+		return nil
+	}
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(encoded, target); err != nil {
+		return fmt.Errorf("Invalid message bus configuration: %s", err)
+	}
+	return nil
+}
+
+// InitBus will initialize a new message bus for the DefaultClient.
 func InitBus(busType string, config interface{}) error {
-	switch busType {
-	case "NATS":
-		// Start NATS
-		bus = new(NATS)
-	case "OSLO":
-		// Start an OSLO producer
-		log.Fatal("OSLO message bus producer is not yet implemented.")
-	case "RABBITMQ":
-		// Start a RabbitMQ producer
-		bus = new(RabbitMQ)
-	default:
-		log.Fatal("No bus type was specified for the producer that we recognize.")
+	c, err := NewClient(busType, config)
+	if err != nil {
+		return err
 	}
-	bus.InitBus(config)
+	DefaultClient.bus = c.bus
 	return nil
 }
 
+// Bus returns the message bus of the client.
+func (c *Client) Bus() MessageBus {
+	return c.bus
+}
+
 // TopicExists abstracts the basic function provided by the MessageBus interface.
-// Spawns a goroutine which loops through and waits for a topic to actually exist.
-// Returns a channel immediately which is read by the user of this function to
-// determine topic existence or timeout by way of the normal time.After pattern
-// in a select{}.
-func TopicExists(topic string) <-chan bool {
-	c := make(chan bool)
-	go func(topic string, c chan bool) {
-		for i := 0; i < 20; i++ {
-			if bus.TopicExists(topic) {
-				c <- true
-			}
-			time.Sleep(100 * time.Millisecond)
+// Spawns a goroutine which waits up to two seconds for a topic to actually
+// exist. Returns a channel immediately on which the goroutine sends true once
+// the topic exists, or false on timeout.
+func (c *Client) TopicExists(topic string) <-chan bool {
+	ch := make(chan bool, 1)
+	go func(topic string, ch chan bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		ch <- c.WaitForTopic(ctx, topic)
+	}(topic, ch)
+	return ch
+}
+
+// WaitForTopic polls the message bus until a topic exists, i.e. has a
+// consumer, and reports whether it does before ctx is done.
+func (c *Client) WaitForTopic(ctx context.Context, topic string) bool {
+	return waitForTopic(ctx, c.bus, topic)
+}
+
+// waitForTopic polls a message bus until a topic exists.
+func waitForTopic(ctx context.Context, bus MessageBus, topic string) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if bus.TopicExists(topic) {
+			return true
 		}
-	}(topic, c)
-	return c
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// TopicExists calls TopicExists on the DefaultClient.
+func TopicExists(topic string) <-chan bool {
+	return DefaultClient.TopicExists(topic)
+}
+
+// WaitForTopic calls WaitForTopic on the DefaultClient.
+func WaitForTopic(ctx context.Context, topic string) bool {
+	return DefaultClient.WaitForTopic(ctx, topic)
 }
 
 // NewApp creates a new signalling channel for use by an application.
+func (c *Client) NewApp() *App {
+	a := &App{
+		client:    c,
+		Stop:      make(chan bool),
+		done:      make(chan struct{}),
+		instances: make(map[*AppInstance]bool),
+	}
+	return a
+}
+
+// NewApp creates a new application using the DefaultClient.
 func NewApp() *App {
-	var a App
-	a.Stop = make(chan bool)
-	return &a
+	return DefaultClient.NewApp()
 }
 
 // Init spawns the goroutine that listens for messages on the signalling channel.
 // Creates a new application instance for the client to utilize.
 // Passes the AppInstance to the AppInstanceHandler function.
 func (a *App) Init(app string, handler AppInstanceHandler) {
-	a.Events = InitConsumer(app)
+	if a.client == nil {
+		a.client = DefaultClient
+	}
+	a.name = app
+	a.Events = a.client.InitConsumer(app)
 	go func(app string, a *App) {
-		for event := range a.Events {
-			var as AppStart
-			json.Unmarshal(event, &as)
-			if as.Application == app {
-				ai := new(AppInstance)
-				ai.InitAppInstance(as.DialogID)
-				go handler(ai)
+		for {
+			select {
+			case event := <-a.Events:
+				var as AppStart
+				json.Unmarshal(event, &as)
+				if as.Application == app {
+					a.startInstance(as.DialogID, handler)
+				}
+			case <-a.Stop:
+				a.stop()
+				return
+			case <-a.done:
+				return
 			}
 		}
 	}(app, a)
@@ -159,93 +419,199 @@ func NewAppInstance() *AppInstance {
 	return &a
 }
 
+// WithContext returns a copy of the application instance whose commands are
+// bound to ctx: they give up as soon as ctx is cancelled or its deadline passes.
+// The copy shares the bus resources and event handlers of the original.
+func (a *AppInstance) WithContext(ctx context.Context) *AppInstance {
+	if ctx == nil {
+		panic("nil context")
+	}
+	a2 := new(AppInstance)
+	*a2 = *a
+	a2.ctx = ctx
+	return a2
+}
+
+// Context returns the context the commands of the application instance are
+// bound to, which is context.Background unless set with WithContext.
+func (a *AppInstance) Context() context.Context {
+	if a.ctx != nil {
+		return a.ctx
+	}
+	return context.Background()
+}
+
+// SetCommandTimeout sets how long each command waits for its response before
+// failing with ErrCommandTimeout. A timeout of zero restores
+// DefaultCommandTimeout. It must be called before the instance issues
+// commands, as commands read the timeout without locking.
+func (a *AppInstance) SetCommandTimeout(timeout time.Duration) {
+	a.timeout = timeout
+}
+
+// InitAppInstance creates an application instance using the message bus of
+// the client and initializes its resources.
+func (c *Client) InitAppInstance(instanceID string) *AppInstance {
+	a := NewAppInstance()
+	a.client = c
+	a.InitAppInstance(instanceID)
+	return a
+}
+
 // InitAppInstance initializes the set of resources necessary for a new application instance.
+// The DefaultClient is used unless the instance was created by a Client.
 func (a *AppInstance) InitAppInstance(instanceID string) {
-	var err error
-	a.Events = make(chan *Event)
-	a.responseChannel = make(chan *CommandResponse)
-	commandTopic := strings.Join([]string{"commands", instanceID}, "_")
-	fmt.Println("Command topic is: ", commandTopic)
-	responseTopic := strings.Join([]string{"responses", instanceID}, "_")
-	a.commandChannel, err = bus.StartProducer(commandTopic)
-	a.commandChannel <- []byte("DUMMY")
-	if err != nil {
-		fmt.Println(err)
+	if a.client == nil {
+		a.client = DefaultClient
 	}
-	eventBus, err := bus.StartConsumer(strings.Join([]string{"events", instanceID}, "_"))
+	a.Events = make(chan *Event)
+	a.quit = make(chan int)
+	a.handlers = &eventHandlers{handlers: make(map[string][]EventHandler)}
+	a.objects = &objectEvents{handles: make(map[string]map[objectHandle]bool), types: make(map[string]bool)}
+	a.state = &instanceState{done: make(chan struct{}), channels: make(map[string]bool)}
+	a.commandTopic = CommandsTopic(instanceID)
+	fmt.Println("Command topic is: ", a.commandTopic)
+	eventBus, err := a.client.bus.StartConsumer(EventsTopic(instanceID))
 	if err != nil {
 		fmt.Println(err)
 	}
-	processEvents(eventBus, a.Events)
-	responseBus, err := bus.StartConsumer(responseTopic)
+	a.state.eventBus = eventBus
+	a.processEvents(eventBus)
+}
+
+// InitProducer initializes a new message bus producer.
+func (c *Client) InitProducer(topic string) chan []byte {
+	producer, err := c.bus.StartProducer(topic)
 	if err != nil {
 		fmt.Println(err)
 	}
-	a.processCommandResponses(responseBus, a.responseChannel)
+	return producer
 }
 
-// InitProducer initializes a new message bus producer.
+// InitProducer initializes a new producer on the bus of the DefaultClient.
 func InitProducer(topic string) chan []byte {
-	producer, err := bus.StartProducer(topic)
+	return DefaultClient.InitProducer(topic)
+}
+
+// InitConsumer initializes a new message bus consumer.
+func (c *Client) InitConsumer(topic string) chan []byte {
+	consumer, err := c.bus.StartConsumer(topic)
 	if err != nil {
 		fmt.Println(err)
 	}
-	return producer
+	return consumer
 }
 
-// InitConsumer initializes a new message bus consumer.
+// InitConsumer initializes a new consumer on the bus of the DefaultClient.
 func InitConsumer(topic string) chan []byte {
-	consumer, err := bus.StartConsumer(topic)
+	return DefaultClient.InitConsumer(topic)
+}
+
+// InitResponder initializes a new message bus responder.
+func (c *Client) InitResponder(topic string) chan *BusRequest {
+	responder, err := c.bus.StartResponder(topic)
 	if err != nil {
 		fmt.Println(err)
 	}
-	return consumer
+	return responder
+}
+
+// InitResponder initializes a new responder on the bus of the DefaultClient.
+func InitResponder(topic string) chan *BusRequest {
+	return DefaultClient.InitResponder(topic)
 }
 
 // processEvents pulls messages off the inboundEvents channel.
 // Takes the events which were pulled off the bus, converts them to Event, and
-// places onto the parsedEvents channel.
-func processEvents(inboundEvents chan []byte, parsedEvents chan *Event) {
-	go func(inboundEvents chan []byte, parsedEvents chan *Event) {
-		for event := range inboundEvents {
+// places onto the Events channel. Once an event has been read from Events, it
+// is dispatched to the handlers registered for its type. The Events channel is
+// closed when the instance is closed.
+func (a *AppInstance) processEvents(inboundEvents chan []byte) {
+	go func(inboundEvents chan []byte) {
+		defer close(a.state.done)
+		defer close(a.Events)
+		for {
+			var event []byte
+			select {
+			case event = <-inboundEvents:
+			case <-a.quit:
+				return
+			}
 			var e Event
 			json.Unmarshal(event, &e)
-			parsedEvents <- &e
+			select {
+			case a.Events <- &e:
+			case <-a.quit:
+				return
+			}
+			a.state.Lock()
+			a.state.dispatching = true
+			a.state.Unlock()
+			if err := a.Dispatch(&e); err != nil {
+				fmt.Println(err)
+			}
+			a.trackChannels(&e)
+			a.state.Lock()
+			a.state.dispatching = false
+			a.state.Unlock()
 		}
-	}(inboundEvents, parsedEvents)
+	}(inboundEvents)
 }
 
 // processCommand is executing the remote command.
-// Performs the work of marshaling the command, sending it across the bus, and
-// then unmarshaling the data in order to return a command response.
-func (a *AppInstance) processCommand(url string, body string, method string) *CommandResponse {
-	jsonMessage, err := json.Marshal(Command{URL: url, Method: method, Body: body})
+// Performs the work of marshaling the command, sending it across the bus as a
+// request to the commands topic, and then unmarshaling the reply in order to
+// return a command response.
+// Returns ErrCommandTimeout when no response arrives in time, or the error of
+// the context of the instance when it is cancelled.
+func (a *AppInstance) processCommand(url string, body string, method string) (*CommandResponse, error) {
+	timeout := a.timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	jsonMessage, err := json.Marshal(Command{UniqueID: UUID(), URL: url, Method: method, Body: body})
 	if err != nil {
-		return &CommandResponse{}
+		return nil, err
 	}
 
-	a.commandChannel <- jsonMessage
-	for {
+	select {
+	case <-a.quit:
+		return nil, ErrInstanceClosed
+	default:
+	}
+	ctx, cancel := context.WithTimeout(a.Context(), timeout)
+	defer cancel()
+	go func() {
 		select {
-		case r, r_ok := <-a.responseChannel:
-			if r_ok {
-				return r
-			}
-		case <-time.After(5 * time.Second):
-			return &CommandResponse{}
+		case <-a.quit:
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+	reply, err := a.client.bus.Request(ctx, a.commandTopic, jsonMessage)
+	if err != nil {
+		select {
+		case <-a.quit:
+			return nil, ErrInstanceClosed
+		default:
+		}
+		if ctx.Err() != nil {
+			return nil, contextError(ctx)
+		}
+		return nil, err
 	}
+	var r CommandResponse
+	if err = json.Unmarshal(reply, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
 }
 
-// processCommandResponses is a function for parsing the Command-Response.
-// processCommandResponses spawns an anonymous go routine which will listen for
-// information on the channel and process them as they arrive.
-func (a *AppInstance) processCommandResponses(fromBus chan []byte, toAppInstance chan *CommandResponse) {
-	go func(fromBus chan []byte, toAppInstance chan *CommandResponse) {
-		for response := range fromBus {
-			var cr CommandResponse
-			json.Unmarshal(response, &cr)
-			toAppInstance <- &cr
-		}
-	}(fromBus, toAppInstance)
+// contextError translates the error of a finished context, reporting an
+// expired deadline as ErrCommandTimeout.
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrCommandTimeout
+	}
+	return ctx.Err()
 }
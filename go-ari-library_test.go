@@ -0,0 +1,38 @@
+package ari
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeConfigDuration(t *testing.T) {
+	tests := []struct {
+		config interface{}
+		want   time.Duration
+	}{
+		{map[string]interface{}{"reconnect_wait": "1.5s"}, 1500 * time.Millisecond},
+		{map[string]interface{}{"reconnect_wait": "250ms"}, 250 * time.Millisecond},
+		{map[string]interface{}{"reconnect_wait": 2 * time.Second}, 2 * time.Second},
+		{map[string]interface{}{"reconnect_wait": Duration(time.Minute)}, time.Minute},
+		{map[string]interface{}{}, 0},
+		{NATSConfig{ReconnectWait: Duration(time.Hour)}, time.Hour},
+		{&NATSConfig{ReconnectWait: Duration(time.Hour)}, time.Hour},
+	}
+	for _, tt := range tests {
+		var c NATSConfig
+		if err := decodeConfig(tt.config, &c); err != nil {
+			t.Errorf("%v: %v", tt.config, err)
+			continue
+		}
+		if got := time.Duration(c.ReconnectWait); got != tt.want {
+			t.Errorf("%v: ReconnectWait is %s, want %s", tt.config, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []interface{}{"soon", "5", true} {
+		var c AsteriskConfig
+		if err := decodeConfig(map[string]interface{}{"start_timeout": invalid}, &c); err == nil {
+			t.Errorf("%v: decoded as %s", invalid, time.Duration(c.StartTimeout))
+		}
+	}
+}
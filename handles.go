@@ -0,0 +1,157 @@
+package ari
+
+import "sync"
+
+// objectHandle is a handle of an ARI object of an application instance, such
+// as a ChannelHandle, to which the events about the object are handed.
+type objectHandle interface {
+	handleEvent(eventType string, v interface{})
+}
+
+// objectEvents hands the events of an application instance to the handles of
+// the objects they are about, named as in a DialogRegistry. A single handler
+// is registered on the instance per event type, however many handles there
+// are, and handles stop receiving events once unwatched.
+type objectEvents struct {
+	sync.Mutex
+	handles map[string]map[objectHandle]bool // by object
+	types   map[string]bool                  // event types handed to handles
+}
+
+// watch hands the events of the given types about an object to a handle.
+func (a *AppInstance) watch(object string, h objectHandle, eventTypes ...string) {
+	o := a.objects
+	o.Lock()
+	defer o.Unlock()
+	handles, ok := o.handles[object]
+	if !ok {
+		handles = make(map[objectHandle]bool)
+		o.handles[object] = handles
+	}
+	handles[h] = true
+	for _, eventType := range eventTypes {
+		if o.types[eventType] {
+			continue
+		}
+		o.types[eventType] = true
+		eventType := eventType
+		a.On(eventType, func(v interface{}) { o.dispatch(eventType, v) })
+	}
+}
+
+// unwatch stops handing the events about an object to a handle.
+func (a *AppInstance) unwatch(object string, h objectHandle) {
+	o := a.objects
+	o.Lock()
+	defer o.Unlock()
+	delete(o.handles[object], h)
+	if len(o.handles[object]) == 0 {
+		delete(o.handles, object)
+	}
+}
+
+// dispatch hands an event to the handles of the objects it is about.
+func (o *objectEvents) dispatch(eventType string, v interface{}) {
+	o.Lock()
+	var handles []objectHandle
+	seen := make(map[objectHandle]bool)
+	for _, object := range eventObjects(v) {
+		for h := range o.handles[object] {
+			if !seen[h] {
+				seen[h] = true
+				handles = append(handles, h)
+			}
+		}
+	}
+	o.Unlock()
+	for _, h := range handles {
+		h.handleEvent(eventType, v)
+	}
+}
+
+// eventObjects returns the objects a decoded event is about: its channels and
+// bridges, and its playback or recording along with their target.
+func eventObjects(v interface{}) []string {
+	var objects []string
+	channel := func(channels ...Channel) {
+		for _, c := range channels {
+			if len(c.Id) > 0 {
+				objects = append(objects, "channel:"+c.Id)
+			}
+		}
+	}
+	bridge := func(bridges ...Bridge) {
+		for _, b := range bridges {
+			if len(b.Id) > 0 {
+				objects = append(objects, "bridge:"+b.Id)
+			}
+		}
+	}
+	target := func(object string, uri string) {
+		objects = append(objects, object)
+		if len(uri) > 0 {
+			objects = append(objects, uri)
+		}
+	}
+	switch e := v.(type) {
+	case *BridgeAttendedTransfer:
+		channel(e.Transferer_First_Leg, e.Transferer_Second_Leg, e.Replace_Channel, e.Transferee,
+			e.Transfer_Target, e.Destination_Link_First_Leg, e.Destination_Link_Second_Leg, e.Destination_Threeway_Channel)
+		bridge(e.Transferer_First_Leg_Bridge, e.Transferer_Second_Leg_Bridge, e.Destination_Threeway_Bridge)
+	case *BridgeBlindTransfer:
+		channel(e.Channel, e.Replace_Channel, e.Transferee)
+		bridge(e.Bridge)
+	case *BridgeCreated:
+		bridge(e.Bridge)
+	case *BridgeDestroyed:
+		bridge(e.Bridge)
+	case *BridgeMerged:
+		bridge(e.Bridge, e.Bridge_From)
+	case *ChannelCallerId:
+		channel(e.Channel)
+	case *ChannelCreated:
+		channel(e.Channel)
+	case *ChannelDestroyed:
+		channel(e.Channel)
+	case *ChannelDialplan:
+		channel(e.Channel)
+	case *ChannelDtmfReceived:
+		channel(e.Channel)
+	case *ChannelEnteredBridge:
+		channel(e.Channel)
+		bridge(e.Bridge)
+	case *ChannelHangupRequest:
+		channel(e.Channel)
+	case *ChannelLeftBridge:
+		channel(e.Channel)
+		bridge(e.Bridge)
+	case *ChannelStateChange:
+		channel(e.Channel)
+	case *ChannelTalkingFinished:
+		channel(e.Channel)
+	case *ChannelTalkingStarted:
+		channel(e.Channel)
+	case *ChannelUserevent:
+		channel(e.Channel)
+		bridge(e.Bridge)
+	case *ChannelVarset:
+		channel(e.Channel)
+	case *Dial:
+		channel(e.Caller, e.Peer, e.Forwarded)
+	case *PlaybackFinished:
+		target("playback:"+e.Playback.Id, e.Playback.Target_Uri)
+	case *PlaybackStarted:
+		target("playback:"+e.Playback.Id, e.Playback.Target_Uri)
+	case *RecordingFailed:
+		target("recording:"+e.Recording.Name, e.Recording.Target_Uri)
+	case *RecordingFinished:
+		target("recording:"+e.Recording.Name, e.Recording.Target_Uri)
+	case *RecordingStarted:
+		target("recording:"+e.Recording.Name, e.Recording.Target_Uri)
+	case *StasisEnd:
+		channel(e.Channel)
+	case *StasisStart:
+		channel(e.Channel, e.Replace_Channel)
+	}
+	return objects
+}
@@ -0,0 +1,551 @@
+package ari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaConfig is the configuration of the Kafka message bus.
+// The topics of all application instances share two Kafka topics, one for
+// events and one for commands, whose messages are keyed by dialog ID so that
+// those of a dialog land on the same partition and stay ordered. Each bus
+// reads a shared topic once, from the messages published after it first
+// subscribed to it, and hands each message to the consumers of its dialog.
+// The other topics, such as those of applications, are Kafka topics of the
+// same name: consumers sharing a consumer group take turns receiving their
+// messages, like the consumers of a NATS queue group, and consumers without a
+// group each receive all the messages published after they started. Topics
+// are expected to exist, or to be created automatically by the brokers.
+type KafkaConfig struct {
+	Brokers       []string       `json:"brokers"`
+	Group         string         `json:"group"`          // consumer group of the consumers of topics other than those of instances, if any
+	Version       string         `json:"version"`        // version of the brokers; "2.0.0" by default
+	ClientID      string         `json:"client_id"`      // client ID sent to the brokers
+	EventsTopic   string         `json:"events_topic"`   // Kafka topic of the events of the instances; "events" by default
+	CommandsTopic string         `json:"commands_topic"` // Kafka topic of the commands of the instances; "commands" by default
+	RepliesTopic  string         `json:"replies_topic"`  // Kafka topic of the replies to requests; "replies" by default
+	PresenceTopic string         `json:"presence_topic"` // Kafka topic of the presence probes of TopicExists; "presence" by default
+	ProbeTimeout  Duration       `json:"probe_timeout"`  // how long TopicExists waits for a consumer to answer
+	Sarama        *sarama.Config `json:"-"`              // base configuration of the Kafka clients, if any
+	Client        sarama.Client  `json:"-"`              // client to use instead of connecting to Brokers, e.g. one of a sarama.MockBroker
+}
+
+// Kafka is a MessageBus using Apache Kafka. Requests are published with the
+// replies topic and a correlation ID in their headers; TopicExists publishes
+// a probe on the presence topic, answered by the buses subscribed to the
+// topic.
+type Kafka struct {
+	config     KafkaConfig
+	client     sarama.Client
+	consumer   sarama.Consumer
+	producer   sarama.SyncProducer
+	lock       sync.Mutex
+	readers    map[string]*kafkaReader // by Kafka topic
+	consumers  map[chan []byte]*kafkaConsumer
+	responders map[chan *BusRequest]*kafkaConsumer
+	subscribed map[string]int // consumers and responders by topic
+	starting   sync.Mutex     // guards replies and presence
+	replies    bool           // whether the replies topic is read
+	presence   bool           // whether the presence topic is read
+	pending    map[string]chan []byte
+}
+
+// kafkaReader reads the partitions of a Kafka topic for the consumers of a
+// bus, until the last of them stops.
+type kafkaReader struct {
+	topic      string
+	partitions []sarama.PartitionConsumer
+	lock       sync.Mutex
+	consumers  map[*kafkaConsumer]bool
+}
+
+// kafkaConsumer is the subscription feeding the channel of a consumer or
+// responder: either a consumer of a reader, or a consumer group member. The
+// consumers of a reader queue their messages so that the reader never waits
+// on a slow consumer.
+type kafkaConsumer struct {
+	topic   string
+	key     string // dialog ID of the topic of an instance; messages of other dialogs are skipped
+	handler func(m *sarama.ConsumerMessage, done chan struct{}) bool
+	reader  *kafkaReader
+	group   sarama.ConsumerGroup
+	cancel  context.CancelFunc
+	done    chan struct{}
+	lock    sync.Mutex
+	ready   *sync.Cond
+	pending []*sarama.ConsumerMessage
+	stopped bool
+}
+
+const (
+	kafkaReplyTo       = "reply_to"
+	kafkaCorrelationID = "correlation_id"
+)
+
+func (k *Kafka) InitBus(config interface{}) error {
+	var err error
+	if err = decodeConfig(config, &k.config); err != nil {
+		return err
+	}
+	if len(k.config.Version) == 0 {
+		k.config.Version = "2.0.0"
+	}
+	if len(k.config.EventsTopic) == 0 {
+		k.config.EventsTopic = "events"
+	}
+	if len(k.config.CommandsTopic) == 0 {
+		k.config.CommandsTopic = "commands"
+	}
+	if len(k.config.RepliesTopic) == 0 {
+		k.config.RepliesTopic = "replies"
+	}
+	if len(k.config.PresenceTopic) == 0 {
+		k.config.PresenceTopic = "presence"
+	}
+	if k.config.ProbeTimeout <= 0 {
+		k.config.ProbeTimeout = Duration(250 * time.Millisecond)
+	}
+	k.readers = make(map[string]*kafkaReader)
+	k.consumers = make(map[chan []byte]*kafkaConsumer)
+	k.responders = make(map[chan *BusRequest]*kafkaConsumer)
+	k.subscribed = make(map[string]int)
+	k.pending = make(map[string]chan []byte)
+
+	k.client = k.config.Client
+	if k.client == nil {
+		c := sarama.NewConfig()
+		if k.config.Sarama != nil {
+			*c = *k.config.Sarama
+		}
+		if c.Version, err = sarama.ParseKafkaVersion(k.config.Version); err != nil {
+			return err
+		}
+		if len(k.config.ClientID) > 0 {
+			c.ClientID = k.config.ClientID
+		}
+		c.Producer.Return.Successes = true
+		c.Producer.Return.Errors = true
+		c.Producer.Partitioner = sarama.NewHashPartitioner
+		c.Consumer.Offsets.Initial = sarama.OffsetNewest
+		if k.client, err = sarama.NewClient(k.config.Brokers, c); err != nil {
+			return err
+		}
+	}
+	if k.producer, err = sarama.NewSyncProducerFromClient(k.client); err == nil {
+		k.consumer, err = sarama.NewConsumerFromClient(k.client)
+	}
+	if err != nil {
+		if k.config.Client == nil {
+			k.client.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// destination returns the Kafka topic of a topic, and the key of its
+// messages: the shared topic and the dialog ID for the topics of instances.
+func (k *Kafka) destination(topic string) (string, string) {
+	kind, dialogID, ok := splitInstanceTopic(topic)
+	switch {
+	case !ok:
+		return topic, ""
+	case kind == "events":
+		return k.config.EventsTopic, dialogID
+	default:
+		return k.config.CommandsTopic, dialogID
+	}
+}
+
+// message creates the message published to a topic.
+func (k *Kafka) message(topic string, body []byte) *sarama.ProducerMessage {
+	kafkaTopic, key := k.destination(topic)
+	m := &sarama.ProducerMessage{Topic: kafkaTopic, Value: sarama.ByteEncoder(body)}
+	if len(key) > 0 {
+		m.Key = sarama.StringEncoder(key)
+	}
+	return m
+}
+
+func (k *Kafka) StartProducer(topic string) (chan []byte, error) {
+	c := make(chan []byte)
+	go func(topic string, messages chan []byte) {
+		for message := range messages {
+			if _, _, err := k.producer.SendMessage(k.message(topic, message)); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}(topic, c)
+	return c, nil
+}
+
+func (k *Kafka) StartConsumer(topic string) (chan []byte, error) {
+	c := make(chan []byte)
+	consumer, err := k.subscribe(topic, func(m *sarama.ConsumerMessage, done chan struct{}) bool {
+		select {
+		case c <- m.Value:
+			return true
+		case <-done:
+			return false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	k.lock.Lock()
+	k.consumers[c] = consumer
+	k.lock.Unlock()
+	return c, nil
+}
+
+// subscribe starts the subscription of a consumer or responder of a topic,
+// which hands the messages of the topic to the handler. The consumers of the
+// topics of instances, and those without a group, are fed by the reader of
+// the Kafka topic; the others join the consumer group. Once subscribed, the
+// bus answers the presence probes of the topic.
+func (k *Kafka) subscribe(topic string, handler func(m *sarama.ConsumerMessage, done chan struct{}) bool) (*kafkaConsumer, error) {
+	if err := k.startPresence(); err != nil {
+		return nil, err
+	}
+	kafkaTopic, key := k.destination(topic)
+	c := &kafkaConsumer{topic: topic, key: key, handler: handler, done: make(chan struct{})}
+	var err error
+	if len(key) > 0 || len(k.config.Group) == 0 {
+		err = k.read(kafkaTopic, c)
+	} else {
+		err = k.join(kafkaTopic, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.lock.Lock()
+	k.subscribed[topic]++
+	k.lock.Unlock()
+	return c, nil
+}
+
+// read adds a consumer to the reader of a Kafka topic, starting it if needed.
+func (k *Kafka) read(topic string, c *kafkaConsumer) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	r, ok := k.readers[topic]
+	if !ok {
+		partitions, err := k.consumer.Partitions(topic)
+		if err != nil {
+			return err
+		}
+		r = &kafkaReader{topic: topic, consumers: make(map[*kafkaConsumer]bool)}
+		for _, partition := range partitions {
+			pc, err := k.consumer.ConsumePartition(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				r.close()
+				return err
+			}
+			r.partitions = append(r.partitions, pc)
+			go r.dispatch(pc)
+		}
+		k.readers[topic] = r
+	}
+	c.ready = sync.NewCond(&c.lock)
+	go c.forward()
+	r.lock.Lock()
+	r.consumers[c] = true
+	r.lock.Unlock()
+	c.reader = r
+	return nil
+}
+
+// dispatch hands the messages of a partition to the consumers of their key.
+func (r *kafkaReader) dispatch(pc sarama.PartitionConsumer) {
+	for m := range pc.Messages() {
+		r.lock.Lock()
+		consumers := make([]*kafkaConsumer, 0, len(r.consumers))
+		for c := range r.consumers {
+			if len(c.key) == 0 || c.key == string(m.Key) {
+				consumers = append(consumers, c)
+			}
+		}
+		r.lock.Unlock()
+		for _, c := range consumers {
+			c.push(m)
+		}
+	}
+}
+
+// push queues a message for the handler of the consumer.
+func (c *kafkaConsumer) push(m *sarama.ConsumerMessage) {
+	c.lock.Lock()
+	c.pending = append(c.pending, m)
+	c.lock.Unlock()
+	c.ready.Signal()
+}
+
+// discard discards the queued messages and ends their forwarding.
+func (c *kafkaConsumer) discard() {
+	c.lock.Lock()
+	c.stopped = true
+	c.pending = nil
+	c.lock.Unlock()
+	c.ready.Signal()
+}
+
+// forward hands the queued messages to the handler of the consumer, in order.
+func (c *kafkaConsumer) forward() {
+	for {
+		c.lock.Lock()
+		for len(c.pending) == 0 && !c.stopped {
+			c.ready.Wait()
+		}
+		if c.stopped {
+			c.lock.Unlock()
+			return
+		}
+		m := c.pending[0]
+		c.pending = c.pending[1:]
+		c.lock.Unlock()
+		if !c.handler(m, c.done) {
+			return
+		}
+	}
+}
+
+// close stops reading the partitions.
+func (r *kafkaReader) close() {
+	for _, pc := range r.partitions {
+		pc.AsyncClose()
+	}
+}
+
+// join joins the consumer group consuming a Kafka topic.
+func (k *Kafka) join(topic string, c *kafkaConsumer) error {
+	group, err := sarama.NewConsumerGroupFromClient(k.config.Group, k.client)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.group, c.cancel = group, cancel
+	go func() {
+		for ctx.Err() == nil {
+			if err := group.Consume(ctx, []string{topic}, c); err != nil {
+				if err == sarama.ErrClosedConsumerGroup {
+					return
+				}
+				fmt.Println(err)
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *kafkaConsumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (c *kafkaConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (c *kafkaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for m := range claim.Messages() {
+		if !c.handler(m, c.done) {
+			return nil
+		}
+		session.MarkMessage(m, "")
+	}
+	return nil
+}
+
+// stop ends the subscription: the consumer leaves the reader, which stops
+// once it has no consumer left, or leaves the consumer group.
+func (k *Kafka) stop(c *kafkaConsumer) error {
+	close(c.done)
+	k.lock.Lock()
+	if k.subscribed[c.topic]--; k.subscribed[c.topic] <= 0 {
+		delete(k.subscribed, c.topic)
+	}
+	if c.reader != nil {
+		c.discard()
+		c.reader.lock.Lock()
+		delete(c.reader.consumers, c)
+		last := len(c.reader.consumers) == 0
+		c.reader.lock.Unlock()
+		if last {
+			c.reader.close()
+			delete(k.readers, c.reader.topic)
+		}
+	}
+	k.lock.Unlock()
+	if c.group != nil {
+		c.cancel()
+		return c.group.Close()
+	}
+	return nil
+}
+
+func (k *Kafka) StopConsumer(consumer chan []byte) error {
+	k.lock.Lock()
+	c, ok := k.consumers[consumer]
+	delete(k.consumers, consumer)
+	k.lock.Unlock()
+	if !ok {
+		return errors.New("Not a consumer of this bus.")
+	}
+	return k.stop(c)
+}
+
+// header returns the value of a header of a message.
+func header(m *sarama.ConsumerMessage, key string) string {
+	for _, h := range m.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// reply publishes the reply to a request or probe on its reply topic.
+func (k *Kafka) reply(m *sarama.ConsumerMessage, response []byte) error {
+	_, _, err := k.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   header(m, kafkaReplyTo),
+		Value:   sarama.ByteEncoder(response),
+		Headers: []sarama.RecordHeader{{Key: []byte(kafkaCorrelationID), Value: []byte(header(m, kafkaCorrelationID))}},
+	})
+	return err
+}
+
+// startPresence starts answering the presence probes of the topics the bus
+// is subscribed to.
+func (k *Kafka) startPresence() error {
+	k.starting.Lock()
+	defer k.starting.Unlock()
+	if k.presence {
+		return nil
+	}
+	err := k.read(k.config.PresenceTopic, &kafkaConsumer{
+		handler: func(m *sarama.ConsumerMessage, done chan struct{}) bool {
+			k.lock.Lock()
+			subscribed := k.subscribed[string(m.Value)] > 0
+			k.lock.Unlock()
+			if subscribed {
+				if err := k.reply(m, nil); err != nil {
+					fmt.Println(err)
+				}
+			}
+			return true
+		},
+		done: make(chan struct{}),
+	})
+	k.presence = err == nil
+	return err
+}
+
+// startReplies starts reading the replies topic, handing the replies to the
+// pending requests and probes of the bus.
+func (k *Kafka) startReplies() error {
+	k.starting.Lock()
+	defer k.starting.Unlock()
+	if k.replies {
+		return nil
+	}
+	err := k.read(k.config.RepliesTopic, &kafkaConsumer{
+		handler: func(m *sarama.ConsumerMessage, done chan struct{}) bool {
+			k.lock.Lock()
+			c, ok := k.pending[header(m, kafkaCorrelationID)]
+			k.lock.Unlock()
+			if ok {
+				select {
+				case c <- m.Value:
+				default: // already answered
+				}
+			}
+			return true
+		},
+		done: make(chan struct{}),
+	})
+	k.replies = err == nil
+	return err
+}
+
+// call publishes a message with the replies topic and a correlation ID in its
+// headers, and waits for the first reply.
+func (k *Kafka) call(ctx context.Context, m *sarama.ProducerMessage) ([]byte, error) {
+	if err := k.startReplies(); err != nil {
+		return nil, err
+	}
+	correlationID := UUID()
+	reply := make(chan []byte, 1)
+	k.lock.Lock()
+	k.pending[correlationID] = reply
+	k.lock.Unlock()
+	defer func() {
+		k.lock.Lock()
+		delete(k.pending, correlationID)
+		k.lock.Unlock()
+	}()
+
+	m.Headers = []sarama.RecordHeader{
+		{Key: []byte(kafkaReplyTo), Value: []byte(k.config.RepliesTopic)},
+		{Key: []byte(kafkaCorrelationID), Value: []byte(correlationID)},
+	}
+	if _, _, err := k.producer.SendMessage(m); err != nil {
+		return nil, err
+	}
+	select {
+	case response := <-reply:
+		return response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TopicExists publishes a presence probe of the topic, and reports whether a
+// bus subscribed to the topic answered it in time.
+func (k *Kafka) TopicExists(topic string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(k.config.ProbeTimeout))
+	defer cancel()
+	_, err := k.call(ctx, &sarama.ProducerMessage{Topic: k.config.PresenceTopic, Value: sarama.StringEncoder(topic)})
+	return err == nil
+}
+
+func (k *Kafka) Request(ctx context.Context, topic string, request []byte) ([]byte, error) {
+	return k.call(ctx, k.message(topic, request))
+}
+
+func (k *Kafka) StartResponder(topic string) (chan *BusRequest, error) {
+	c := make(chan *BusRequest)
+	responder, err := k.subscribe(topic, func(m *sarama.ConsumerMessage, done chan struct{}) bool {
+		r := NewBusRequest(m.Value, func(response []byte) error {
+			return k.reply(m, response)
+		})
+		select {
+		case c <- r:
+			return true
+		case <-done:
+			return false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	k.lock.Lock()
+	k.responders[c] = responder
+	k.lock.Unlock()
+	return c, nil
+}
+
+func (k *Kafka) StopResponder(responder chan *BusRequest) error {
+	k.lock.Lock()
+	r, ok := k.responders[responder]
+	delete(k.responders, responder)
+	k.lock.Unlock()
+	if !ok {
+		return errors.New("Not a responder of this bus.")
+	}
+	return k.stop(r)
+}
@@ -0,0 +1,161 @@
+package ari
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// newTestKafka creates a Kafka bus on a mock broker answering with the given
+// responses, besides the metadata of the topics.
+func newTestKafka(t *testing.T, topics []string, responses map[string]sarama.MockResponse) (*Kafka, *sarama.MockBroker) {
+	broker := sarama.NewMockBroker(t, 1)
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID())
+	for _, topic := range topics {
+		metadata.SetLeader(topic, 0, broker.BrokerID())
+	}
+	responses["MetadataRequest"] = metadata
+	broker.SetHandlerByMap(responses)
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_11_0_0
+	config.Producer.Return.Successes = true
+	config.Consumer.Return.Errors = true
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Kafka{}
+	if err := k.InitBus(KafkaConfig{Client: client}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		broker.Close()
+	})
+	return k, broker
+}
+
+func TestKafkaMessage(t *testing.T) {
+	k := &Kafka{config: KafkaConfig{EventsTopic: "ari.events", CommandsTopic: "ari.commands"}}
+	cases := []struct {
+		topic, kafkaTopic, key string
+	}{
+		{"events_d1", "ari.events", "d1"},
+		{"commands_d1", "ari.commands", "d1"},
+		{"voicemail", "voicemail", ""},
+	}
+	for _, c := range cases {
+		m := k.message(c.topic, []byte("{}"))
+		var key string
+		if m.Key != nil {
+			encoded, _ := m.Key.Encode()
+			key = string(encoded)
+		}
+		if m.Topic != c.kafkaTopic || key != c.key {
+			t.Errorf("%s: got %s %q, want %s %q", c.topic, m.Topic, key, c.kafkaTopic, c.key)
+		}
+	}
+}
+
+func TestKafkaProducerSharedTopic(t *testing.T) {
+	produce := &sarama.ProduceResponse{Version: 3}
+	produce.AddTopicPartition("events", 0, sarama.ErrNoError)
+	k, broker := newTestKafka(t, []string{"events"}, map[string]sarama.MockResponse{
+		"ProduceRequest": sarama.NewMockWrapper(produce),
+	})
+	if _, _, err := k.producer.SendMessage(k.message(EventsTopic("d1"), []byte("{}"))); err != nil {
+		t.Fatal(err)
+	}
+	produced := 0
+	for _, r := range broker.History() {
+		if _, ok := r.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	if produced != 1 {
+		t.Fatalf("got %d produce requests, want 1", produced)
+	}
+}
+
+func TestKafkaConsumerFiltersDialog(t *testing.T) {
+	fetch := &sarama.FetchResponse{Version: 4}
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d2"), sarama.StringEncoder("a"), 0)
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d1"), sarama.StringEncoder("b"), 1)
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d1"), sarama.StringEncoder("c"), 2)
+	fetch.AddError("presence", 0, sarama.ErrNoError)
+	offsets := &sarama.OffsetResponse{Version: 1}
+	offsets.AddTopicPartition("events", 0, 0)
+	offsets.AddTopicPartition("presence", 0, 0)
+	k, broker := newTestKafka(t, []string{"events", "presence"}, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockWrapper(offsets),
+		"FetchRequest":  sarama.NewMockWrapper(fetch),
+	})
+	c, err := k.StartConsumer(EventsTopic("d1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"b", "c"} {
+		select {
+		case got := <-c:
+			if string(got) != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No message %s.", want)
+		}
+	}
+	if err := k.StopConsumer(c); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range broker.History() {
+		switch r.Request.(type) {
+		case *sarama.FindCoordinatorRequest, *sarama.JoinGroupRequest:
+			t.Fatal("Consumer group joined.")
+		}
+	}
+	if len(k.readers) != 1 {
+		t.Fatalf("got %d readers, want the presence reader only", len(k.readers))
+	}
+}
+
+func TestKafkaSlowConsumer(t *testing.T) {
+	fetch := &sarama.FetchResponse{Version: 4}
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d1"), sarama.StringEncoder("a"), 0)
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d2"), sarama.StringEncoder("b"), 1)
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d1"), sarama.StringEncoder("c"), 2)
+	fetch.AddRecord("events", 0, sarama.StringEncoder("d2"), sarama.StringEncoder("d"), 3)
+	fetch.AddError("presence", 0, sarama.ErrNoError)
+	offsets := &sarama.OffsetResponse{Version: 1}
+	offsets.AddTopicPartition("events", 0, 0)
+	offsets.AddTopicPartition("presence", 0, 0)
+	k, _ := newTestKafka(t, []string{"events", "presence"}, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockWrapper(offsets),
+		"FetchRequest":  sarama.NewMockWrapper(fetch),
+	})
+	// The instance of d1 does not read its events.
+	slow, err := k.StartConsumer(EventsTopic("d1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := k.StartConsumer(EventsTopic("d2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"b", "d"} {
+		select {
+		case got := <-c:
+			if string(got) != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No message %s.", want)
+		}
+	}
+	for _, consumer := range []chan []byte{slow, c} {
+		if err := k.StopConsumer(consumer); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ari
+
+import (
+	"context"
+	"sync"
+)
+
+// instanceState holds what an application instance needs to shut down: the
+// consumer it subscribed, whether the goroutine processing it is running event
+// handlers, and the channels in the application, whose departure ends the
+// instance.
+type instanceState struct {
+	sync.Mutex  // guards dispatching and channels
+	once        sync.Once
+	err         error
+	done        chan struct{} // closed once the goroutine processing events returned
+	eventBus    chan []byte
+	dispatching bool
+	channels    map[string]bool
+}
+
+// Close releases the resources of the application instance: it unsubscribes
+// from the events topic, waits for the goroutine processing it and closes the
+// Events channel. Pending and later commands fail with ErrInstanceClosed.
+// Close is called automatically when the last channel of the instance leaves
+// the application, and may be called several times.
+// When called while an event handler runs, e.g. by the handler itself, Close
+// returns without waiting for it; Done is closed once it returned.
+func (a *AppInstance) Close() error {
+	if a.state == nil {
+		return nil // never initialized
+	}
+	a.state.once.Do(func() {
+		close(a.quit)
+		if a.state.eventBus != nil {
+			a.state.err = a.client.bus.StopConsumer(a.state.eventBus)
+		}
+	})
+	a.state.Lock()
+	dispatching := a.state.dispatching
+	a.state.Unlock()
+	if !dispatching {
+		<-a.state.done
+	}
+	return a.state.err
+}
+
+// Done returns a channel which is closed once the application instance has
+// been closed.
+func (a *AppInstance) Done() <-chan struct{} {
+	return a.state.done
+}
+
+// trackChannels keeps track of the channels in the application, and closes the
+// instance when a StasisEnd event reports that the last of them left.
+func (a *AppInstance) trackChannels(e *Event) {
+	switch e.Type {
+	case "StasisStart", "StasisEnd":
+	default:
+		return
+	}
+	v, err := DecodeEvent(e)
+	if err != nil {
+		return
+	}
+	a.state.Lock()
+	last := false
+	switch ev := v.(type) {
+	case *StasisStart:
+		a.state.channels[ev.Channel.Id] = true
+	case *StasisEnd:
+		delete(a.state.channels, ev.Channel.Id)
+		last = len(a.state.channels) == 0
+	}
+	a.state.Unlock()
+	if last {
+		a.Close()
+	}
+}
+
+// startInstance creates an application instance for a dialog, and runs the
+// handler of the application for it.
+func (a *App) startInstance(dialogID string, handler AppInstanceHandler) {
+	ai := a.client.InitAppInstance(dialogID)
+	a.lock.Lock()
+	select {
+	case <-a.done:
+		a.lock.Unlock()
+		ai.Close()
+		return
+	default:
+	}
+	a.instances[ai] = true
+	a.lock.Unlock()
+	go func() {
+		<-ai.Done()
+		a.lock.Lock()
+		delete(a.instances, ai)
+		a.lock.Unlock()
+	}()
+	a.running.Add(1)
+	go func() {
+		defer a.running.Done()
+		handler(ai)
+	}()
+}
+
+// stop unsubscribes the application from its topic and closes its instances.
+func (a *App) stop() {
+	a.stopOnce.Do(func() {
+		close(a.done)
+		if a.Events != nil {
+			a.client.bus.StopConsumer(a.Events)
+		}
+		a.lock.Lock()
+		instances := make([]*AppInstance, 0, len(a.instances))
+		for ai := range a.instances {
+			instances = append(instances, ai)
+		}
+		a.lock.Unlock()
+		for _, ai := range instances {
+			ai.Close()
+		}
+	})
+}
+
+// Shutdown stops the application from starting new instances, closes its
+// running instances and waits for their AppInstanceHandler to return, or for
+// ctx to be done.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.stop()
+	finished := make(chan struct{})
+	go func() {
+		a.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// eventSender returns a function publishing ARI events, in order, on the
+// events topic of the instance d1.
+func eventSender(t *testing.T, a *AppInstance) func(eventType string, body string) {
+	events, err := a.client.bus.StartProducer(EventsTopic("d1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { close(events) })
+	return func(eventType string, body string) {
+		message, _ := json.Marshal(Event{Type: eventType, ARI_Body: body})
+		events <- message
+	}
+}
+
+// waitDone waits for the instance to be closed.
+func waitDone(t *testing.T, a *AppInstance) {
+	select {
+	case <-a.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Instance not closed")
+	}
+}
+
+func TestCloseFromHandler(t *testing.T) {
+	a, _ := newTestInstance(t, 200, `{}`)
+	returned := make(chan error, 1)
+	a.OnChannelHangupRequest(func(*ChannelHangupRequest) {
+		returned <- a.Close()
+	})
+	go a.Run()
+	sendEvent := eventSender(t, a)
+	sendEvent("ChannelHangupRequest", `{"channel":{"id":"c1"}}`)
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close called from a handler did not return")
+	}
+	waitDone(t, a)
+	if err := a.ChannelsAnswer("c1"); err != ErrInstanceClosed {
+		t.Errorf("Command after Close failed with %v, want ErrInstanceClosed", err)
+	}
+}
+
+func TestCloseWaitsForEvents(t *testing.T) {
+	a, _ := newTestInstance(t, 200, `{}`)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-a.Done():
+	default:
+		t.Error("Close returned before the instance was closed")
+	}
+	if _, ok := <-a.Events; ok {
+		t.Error("Events not closed")
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+}
+
+func TestCloseOnLastStasisEnd(t *testing.T) {
+	a, _ := newTestInstance(t, 200, `{}`)
+	go a.Run()
+	sendEvent := eventSender(t, a)
+	sendEvent("StasisStart", `{"channel":{"id":"c1"}}`)
+	sendEvent("StasisStart", `{"channel":{"id":"c2"}}`)
+	sendEvent("StasisEnd", `{"channel":{"id":"c1"}}`)
+	if err := a.ChannelsAnswer("c2"); err != nil {
+		t.Fatalf("Command with a channel left failed: %v", err)
+	}
+	select {
+	case <-a.Done():
+		t.Fatal("Instance closed with a channel left")
+	default:
+	}
+	sendEvent("StasisEnd", `{"channel":{"id":"c2"}}`)
+	waitDone(t, a)
+}
+
+func TestAppShutdown(t *testing.T) {
+	client, _ := NewClient("MEMORY", MemoryConfig{Broker: "test-" + UUID()})
+	started := make(chan *AppInstance, 1)
+	release := make(chan struct{})
+	app := client.NewApp()
+	app.Init("vm", func(a *AppInstance) {
+		started <- a
+		<-a.Done()
+		<-release
+	})
+	appStart, _ := client.bus.StartProducer("vm")
+	message, _ := json.Marshal(AppStart{Application: "vm", DialogID: "d1"})
+	appStart <- message
+	var a *AppInstance
+	select {
+	case a = <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("No instance started")
+	}
+
+	// Shutdown closes the instances, then waits for their handlers.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown with a running handler returned %v, want context.DeadlineExceeded", err)
+	}
+	waitDone(t, a)
+	close(release)
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
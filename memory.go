@@ -0,0 +1,253 @@
+package ari
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// memoryBrokers holds the brokers of the Memory message buses of the process,
+// by name. Buses configured with the same broker name exchange messages.
+var memoryBrokers = struct {
+	sync.Mutex
+	brokers map[string]*memoryBroker
+}{brokers: make(map[string]*memoryBroker)}
+
+// MemoryConfig is the configuration of the in-memory message bus.
+type MemoryConfig struct {
+	Broker string `json:"broker"` // name of the broker shared with other Memory buses
+	Queue  string `json:"queue"`  // queue group of the consumers, if any
+}
+
+// Memory is a MessageBus whose topics live in the memory of the process, for
+// tests and for running the proxy and applications in a single binary. Its
+// semantics follow the NATS backend: messages are delivered to every consumer
+// of a topic, except that consumers sharing a queue group take turns receiving
+// them, and messages published to a topic without consumers are dropped.
+// Requests are handed to the responders of their topic in turn.
+type Memory struct {
+	config MemoryConfig
+	broker *memoryBroker
+}
+
+// memoryBroker routes the messages published on a topic to its subscriptions.
+type memoryBroker struct {
+	sync.Mutex
+	topics     map[string][]*memorySubscription
+	turns      map[string]int // next member of each queue group to receive a message
+	responders map[string][]*memoryResponder
+	next       map[string]int // next responder of each topic to receive a request
+}
+
+// memoryResponder is a responder of a topic.
+type memoryResponder struct {
+	out  chan *BusRequest
+	done chan struct{}
+}
+
+// memorySubscription queues the messages of a consumer so that publishers
+// never wait on slow consumers.
+type memorySubscription struct {
+	queue   string
+	out     chan []byte
+	done    chan struct{}
+	lock    sync.Mutex
+	ready   *sync.Cond
+	pending [][]byte
+	stopped bool
+}
+
+func (m *Memory) InitBus(config interface{}) error {
+	if err := decodeConfig(config, &m.config); err != nil {
+		return err
+	}
+
+	memoryBrokers.Lock()
+	defer memoryBrokers.Unlock()
+	m.broker = memoryBrokers.brokers[m.config.Broker]
+	if m.broker == nil {
+		m.broker = &memoryBroker{
+			topics:     make(map[string][]*memorySubscription),
+			turns:      make(map[string]int),
+			responders: make(map[string][]*memoryResponder),
+			next:       make(map[string]int),
+		}
+		memoryBrokers.brokers[m.config.Broker] = m.broker
+	}
+	return nil
+}
+
+func (m *Memory) StartProducer(topic string) (chan []byte, error) {
+	c := make(chan []byte)
+	go func(topic string, messages chan []byte) {
+		for message := range messages {
+			m.broker.publish(topic, message)
+		}
+	}(topic, c)
+	return c, nil
+}
+
+func (m *Memory) StartConsumer(topic string) (chan []byte, error) {
+	s := &memorySubscription{queue: m.config.Queue, out: make(chan []byte), done: make(chan struct{})}
+	s.ready = sync.NewCond(&s.lock)
+	go s.forward()
+	m.broker.Lock()
+	m.broker.topics[topic] = append(m.broker.topics[topic], s)
+	m.broker.Unlock()
+	return s.out, nil
+}
+
+func (m *Memory) StopConsumer(consumer chan []byte) error {
+	m.broker.Lock()
+	defer m.broker.Unlock()
+	for topic, subscriptions := range m.broker.topics {
+		for i, s := range subscriptions {
+			if s.out != consumer {
+				continue
+			}
+			m.broker.topics[topic] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+			if len(m.broker.topics[topic]) == 0 {
+				delete(m.broker.topics, topic)
+			}
+			s.stop()
+			return nil
+		}
+	}
+	return errors.New("Not a consumer of this bus.")
+}
+
+// TopicExists reports whether the topic has at least one consumer or
+// responder.
+func (m *Memory) TopicExists(topic string) bool {
+	m.broker.Lock()
+	defer m.broker.Unlock()
+	return len(m.broker.topics[topic]) > 0 || len(m.broker.responders[topic]) > 0
+}
+
+func (m *Memory) Request(ctx context.Context, topic string, request []byte) ([]byte, error) {
+	m.broker.Lock()
+	responders := m.broker.responders[topic]
+	if len(responders) == 0 {
+		m.broker.Unlock()
+		return nil, errors.New("No responder for topic: " + topic)
+	}
+	turn := m.broker.next[topic] % len(responders)
+	m.broker.next[topic] = turn + 1
+	responder := responders[turn]
+	m.broker.Unlock()
+
+	body := make([]byte, len(request))
+	copy(body, request)
+	replies := make(chan []byte, 1)
+	r := NewBusRequest(body, func(response []byte) error {
+		select {
+		case replies <- response:
+			return nil
+		default:
+			return errors.New("Request already answered.")
+		}
+	})
+	select {
+	case responder.out <- r:
+	case <-responder.done:
+		return nil, errors.New("No responder for topic: " + topic)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case reply := <-replies:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *Memory) StartResponder(topic string) (chan *BusRequest, error) {
+	r := &memoryResponder{out: make(chan *BusRequest), done: make(chan struct{})}
+	m.broker.Lock()
+	m.broker.responders[topic] = append(m.broker.responders[topic], r)
+	m.broker.Unlock()
+	return r.out, nil
+}
+
+func (m *Memory) StopResponder(responder chan *BusRequest) error {
+	m.broker.Lock()
+	defer m.broker.Unlock()
+	for topic, responders := range m.broker.responders {
+		for i, r := range responders {
+			if r.out != responder {
+				continue
+			}
+			m.broker.responders[topic] = append(responders[:i:i], responders[i+1:]...)
+			if len(m.broker.responders[topic]) == 0 {
+				delete(m.broker.responders, topic)
+			}
+			close(r.done)
+			return nil
+		}
+	}
+	return errors.New("Not a responder of this bus.")
+}
+
+// publish delivers a message to every subscription of the topic without a
+// queue group, and to one member of each queue group.
+func (b *memoryBroker) publish(topic string, message []byte) {
+	b.Lock()
+	defer b.Unlock()
+	groups := make(map[string][]*memorySubscription)
+	for _, s := range b.topics[topic] {
+		if len(s.queue) == 0 {
+			s.push(message)
+			continue
+		}
+		groups[s.queue] = append(groups[s.queue], s)
+	}
+	for queue, members := range groups {
+		key := topic + " " + queue
+		turn := b.turns[key] % len(members)
+		b.turns[key] = turn + 1
+		members[turn].push(message)
+	}
+}
+
+// push queues a copy of the message for delivery to the consumer.
+func (s *memorySubscription) push(message []byte) {
+	m := make([]byte, len(message))
+	copy(m, message)
+	s.lock.Lock()
+	s.pending = append(s.pending, m)
+	s.lock.Unlock()
+	s.ready.Signal()
+}
+
+// stop discards the queued messages and ends the delivery to the consumer.
+func (s *memorySubscription) stop() {
+	s.lock.Lock()
+	s.stopped = true
+	s.pending = nil
+	s.lock.Unlock()
+	close(s.done)
+	s.ready.Signal()
+}
+
+// forward delivers the queued messages to the consumer channel, in order.
+func (s *memorySubscription) forward() {
+	for {
+		s.lock.Lock()
+		for len(s.pending) == 0 && !s.stopped {
+			s.ready.Wait()
+		}
+		if s.stopped {
+			s.lock.Unlock()
+			return
+		}
+		message := s.pending[0]
+		s.pending = s.pending[1:]
+		s.lock.Unlock()
+		select {
+		case s.out <- message:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package ari
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestMemory creates a Memory bus on the given broker, whose consumers join
+// the given queue group if any.
+func newTestMemory(t *testing.T, broker string, queue string) *Memory {
+	m := new(Memory)
+	if err := m.InitBus(MemoryConfig{Broker: broker, Queue: queue}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// received returns the messages a consumer received within a short delay.
+func received(consumer chan []byte) []string {
+	var messages []string
+	for {
+		select {
+		case message := <-consumer:
+			messages = append(messages, string(message))
+		case <-time.After(50 * time.Millisecond):
+			return messages
+		}
+	}
+}
+
+func TestMemoryFanOut(t *testing.T) {
+	broker := "test-" + UUID()
+	m, n := newTestMemory(t, broker, ""), newTestMemory(t, broker, "")
+	c1, _ := m.StartConsumer("x")
+	c2, _ := n.StartConsumer("x")
+	other, _ := n.StartConsumer("y")
+	p, _ := m.StartProducer("x")
+	p <- []byte("a")
+	p <- []byte("b")
+	for i, c := range []chan []byte{c1, c2} {
+		if got := received(c); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+			t.Errorf("Consumer %d received %v, want [a b]", i+1, got)
+		}
+	}
+	if got := received(other); len(got) != 0 {
+		t.Errorf("Consumer of another topic received %v", got)
+	}
+	// Buses on other brokers share nothing.
+	if newTestMemory(t, "test-"+UUID(), "").TopicExists("x") {
+		t.Error("Topic exists on another broker")
+	}
+}
+
+func TestMemoryQueueGroup(t *testing.T) {
+	broker := "test-" + UUID()
+	q1, q2 := newTestMemory(t, broker, "q"), newTestMemory(t, broker, "q")
+	c1, _ := q1.StartConsumer("x")
+	c2, _ := q2.StartConsumer("x")
+	c3, _ := newTestMemory(t, broker, "").StartConsumer("x")
+	p, _ := q1.StartProducer("x")
+	for _, message := range []string{"a", "b", "c", "d"} {
+		p <- []byte(message)
+	}
+	// Members of the group take turns, consumers without a group receive all.
+	if got := received(c1); len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Errorf("First member received %v, want [a c]", got)
+	}
+	if got := received(c2); len(got) != 2 || got[0] != "b" || got[1] != "d" {
+		t.Errorf("Second member received %v, want [b d]", got)
+	}
+	if got := received(c3); len(got) != 4 {
+		t.Errorf("Consumer without a group received %v, want [a b c d]", got)
+	}
+}
+
+func TestMemoryStopConsumer(t *testing.T) {
+	m := newTestMemory(t, "test-"+UUID(), "")
+	c1, _ := m.StartConsumer("x")
+	c2, _ := m.StartConsumer("x")
+	if err := m.StopConsumer(c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StopConsumer(c1); err == nil {
+		t.Error("Stopped a consumer twice")
+	}
+	p, _ := m.StartProducer("x")
+	p <- []byte("a")
+	if got := received(c1); len(got) != 0 {
+		t.Errorf("Stopped consumer received %v", got)
+	}
+	if got := received(c2); len(got) != 1 {
+		t.Errorf("Consumer received %v, want [a]", got)
+	}
+	if !m.TopicExists("x") {
+		t.Error("Topic with a consumer left does not exist")
+	}
+	m.StopConsumer(c2)
+	if m.TopicExists("x") {
+		t.Error("Topic without consumers exists")
+	}
+	// Messages published without consumers are dropped. Once the producer took
+	// the next message, the previous one was published.
+	p <- []byte("b")
+	p <- []byte("c")
+	c3, _ := m.StartConsumer("x")
+	for _, message := range received(c3) {
+		if message == "b" {
+			t.Error("New consumer received a message published before it started")
+		}
+	}
+}
+
+func TestMemoryRequest(t *testing.T) {
+	m := newTestMemory(t, "test-"+UUID(), "")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.Request(ctx, "x", []byte("ping")); err == nil {
+		t.Error("Request without a responder succeeded")
+	}
+
+	// Responders take turns.
+	var responders []chan *BusRequest
+	for _, name := range []string{"r1", "r2"} {
+		responder, _ := m.StartResponder("x")
+		responders = append(responders, responder)
+		go func(name string, responder chan *BusRequest) {
+			for request := range responder {
+				request.Reply([]byte(name + ":" + string(request.Body)))
+			}
+		}(name, responder)
+	}
+	if !m.TopicExists("x") {
+		t.Error("Topic with responders does not exist")
+	}
+	for _, want := range []string{"r1:a", "r2:b", "r1:c"} {
+		reply, err := m.Request(ctx, "x", []byte(want[len(want)-1:]))
+		if err != nil || string(reply) != want {
+			t.Errorf("Request answered %q, %v, want %s", reply, err, want)
+		}
+	}
+
+	for _, responder := range responders {
+		if err := m.StopResponder(responder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Request(ctx, "x", []byte("ping")); err == nil {
+		t.Error("Request after StopResponder succeeded")
+	}
+}
@@ -1,37 +1,81 @@
 package ari
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/apcera/nats"
 )
 
-type natsConfig struct {
-	URL   string `json:"url"`
-	Queue string `json:"queue"`
+// NATSConfig is the configuration of the NATS message bus.
+// The NATS client reconnects on its own, resubscribes the consumers and buffers
+// the messages published while disconnected.
+type NATSConfig struct {
+	URL           string                `json:"url"`
+	Queue         string                `json:"queue"`          // queue group of the consumers, if any
+	ReconnectWait Duration              `json:"reconnect_wait"` // delay between reconnection attempts
+	MaxReconnect  int                   `json:"max_reconnect"`  // attempts before giving up; 0 means never give up
+	ProbeTimeout  Duration              `json:"probe_timeout"`  // how long TopicExists waits for a consumer to answer
+	OnStateChange func(ConnectionState) `json:"-"`
 }
 type NATS struct {
-	config     natsConfig
+	config     NATSConfig
 	connection *nats.Conn
 	encoder    *nats.EncodedConn
+	lock       sync.Mutex
+	consumers  map[chan []byte]*natsConsumer
+	responders map[chan *BusRequest]*natsConsumer
+}
+
+// natsConsumer is the subscription feeding the channel of a consumer or
+// responder, and the one answering the presence probes of its topic.
+type natsConsumer struct {
+	subscription *nats.Subscription
+	presence     *nats.Subscription
+	done         chan struct{}
+}
+
+// presenceSubject returns the subject on which the consumers of a topic answer
+// presence probes.
+func presenceSubject(topic string) string {
+	return "_PRESENCE." + topic
 }
 
 func (n *NATS) InitBus(config interface{}) error {
 	var err error
-	c := config.(map[string]interface{})
-	for key, value := range c {
-		switch key {
-		case "url":
-			n.config.URL = value.(string)
-		case "queue":
-			n.config.Queue = value.(string)
-		}
+	if err = decodeConfig(config, &n.config); err != nil {
+		return err
+	}
+	n.consumers = make(map[chan []byte]*natsConsumer)
+	n.responders = make(map[chan *BusRequest]*natsConsumer)
+	if n.config.ProbeTimeout <= 0 {
+		n.config.ProbeTimeout = Duration(250 * time.Millisecond)
 	}
 
-	n.connection, err = nats.Connect(n.config.URL)
+	options := nats.DefaultOptions
+	options.Url = n.config.URL
+	options.AllowReconnect = true
+	options.MaxReconnect = n.config.MaxReconnect
+	if options.MaxReconnect == 0 {
+		options.MaxReconnect = -1
+	}
+	if n.config.ReconnectWait > 0 {
+		options.ReconnectWait = time.Duration(n.config.ReconnectWait)
+	}
+	if n.config.OnStateChange != nil {
+		options.DisconnectedCB = func(*nats.Conn) { n.config.OnStateChange(Disconnected) }
+		options.ReconnectedCB = func(*nats.Conn) { n.config.OnStateChange(Reconnected) }
+		options.ClosedCB = func(*nats.Conn) { n.config.OnStateChange(ConnectionClosed) }
+	}
+	n.connection, err = options.Connect()
 	if err != nil {
 		return err
 	}
 	n.encoder, err = nats.NewEncodedConn(n.connection, "default")
 	if err != nil {
+		n.connection.Close()
 		return err
 	}
 	return nil
@@ -48,13 +92,115 @@ func (n *NATS) StartProducer(topic string) (chan []byte, error) {
 
 func (n *NATS) StartConsumer(topic string) (chan []byte, error) {
 	c := make(chan []byte)
-	_, err := n.encoder.BindRecvQueueChan(topic, n.config.Queue, c)
+	consumer, err := n.subscribe(topic, func(m *nats.Msg, done chan struct{}) {
+		select {
+		case c <- m.Data:
+		case <-done:
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
+	n.lock.Lock()
+	n.consumers[c] = consumer
+	n.lock.Unlock()
 	return c, nil
 }
 
+// subscribe subscribes the handler to a topic, in the queue group of the
+// consumers, and answers the presence probes of the topic.
+func (n *NATS) subscribe(topic string, handler func(m *nats.Msg, done chan struct{})) (*natsConsumer, error) {
+	done := make(chan struct{})
+	subscription, err := n.connection.QueueSubscribe(topic, n.config.Queue, func(m *nats.Msg) {
+		handler(m, done)
+	})
+	if err != nil {
+		return nil, err
+	}
+	presence, err := n.connection.Subscribe(presenceSubject(topic), func(m *nats.Msg) {
+		n.connection.Publish(m.Reply, nil)
+	})
+	if err != nil {
+		subscription.Unsubscribe()
+		return nil, err
+	}
+	return &natsConsumer{subscription: subscription, presence: presence, done: done}, nil
+}
+
+// unsubscribe stops the subscriptions of a consumer or responder.
+func (c *natsConsumer) unsubscribe() error {
+	close(c.done)
+	c.presence.Unsubscribe()
+	return c.subscription.Unsubscribe()
+}
+
+func (n *NATS) StopConsumer(consumer chan []byte) error {
+	n.lock.Lock()
+	c, ok := n.consumers[consumer]
+	delete(n.consumers, consumer)
+	n.lock.Unlock()
+	if !ok {
+		return errors.New("Not a consumer of this bus.")
+	}
+	return c.unsubscribe()
+}
+
+// TopicExists probes the consumers of the topic, and reports whether one of
+// them answers within the probe timeout.
 func (n *NATS) TopicExists(topic string) bool {
-	return true
+	_, err := n.connection.Request(presenceSubject(topic), nil, time.Duration(n.config.ProbeTimeout))
+	return err == nil
+}
+
+// Request publishes the request with a reply subject of its own, on which it
+// waits for the first reply.
+func (n *NATS) Request(ctx context.Context, topic string, request []byte) ([]byte, error) {
+	replies := make(chan *nats.Msg, 1)
+	inbox := nats.NewInbox()
+	subscription, err := n.connection.ChanSubscribe(inbox, replies)
+	if err != nil {
+		return nil, err
+	}
+	defer subscription.Unsubscribe()
+	if err = n.connection.PublishRequest(topic, inbox, request); err != nil {
+		return nil, err
+	}
+	select {
+	case m := <-replies:
+		return m.Data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (n *NATS) StartResponder(topic string) (chan *BusRequest, error) {
+	c := make(chan *BusRequest)
+	responder, err := n.subscribe(topic, func(m *nats.Msg, done chan struct{}) {
+		reply := m.Reply
+		r := NewBusRequest(m.Data, func(response []byte) error {
+			return n.connection.Publish(reply, response)
+		})
+		select {
+		case c <- r:
+		case <-done:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	n.lock.Lock()
+	n.responders[c] = responder
+	n.lock.Unlock()
+	return c, nil
+}
+
+func (n *NATS) StopResponder(responder chan *BusRequest) error {
+	n.lock.Lock()
+	r, ok := n.responders[responder]
+	delete(n.responders, responder)
+	n.lock.Unlock()
+	if !ok {
+		return errors.New("Not a responder of this bus.")
+	}
+	return r.unsubscribe()
 }
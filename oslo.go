@@ -0,0 +1,427 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// OSLOConfig is the configuration of the OSLO message bus. It extends the
+// configuration of the RabbitMQ message bus, whose topic exchange defaults to
+// "openstack", the control exchange of oslo.messaging.
+type OSLOConfig struct {
+	RabbitMQConfig
+	Method string `json:"method"` // method of the casts and calls sent; "ari_message" by default
+}
+
+// OSLO is a MessageBus interoperating with OpenStack services through
+// oslo.messaging over RabbitMQ. Messages are casts, and requests calls, of
+// Method with the topic and the message as arguments, wrapped in the
+// oslo.message/oslo.version envelope. Replies are sent to the direct exchange
+// named by the _reply_q of the call; a failure reply is returned by Request as
+// a *RemoteError. Casts from OpenStack services are received with the args of
+// the cast as message, unless it has a message or text argument.
+type OSLO struct {
+	config     OSLOConfig
+	bus        RabbitMQ
+	lock       sync.Mutex
+	consumers  map[chan []byte]*osloConsumer
+	responders map[chan *BusRequest]*osloConsumer
+	replyQueue string // empty until a call was made
+	replies    map[string]chan *osloMessage
+}
+
+// osloConsumer unwraps the messages of a RabbitMQ consumer.
+type osloConsumer struct {
+	raw  chan []byte
+	done chan struct{}
+}
+
+// osloVersion is the version of the envelope of oslo.messaging.
+const osloVersion = "2.0"
+
+type osloEnvelope struct {
+	Version string `json:"oslo.version"`
+	Message string `json:"oslo.message"`
+}
+
+// osloMessage is a cast, a call or the reply to a call.
+type osloMessage struct {
+	Method   string                     `json:"method,omitempty"`
+	Args     map[string]json.RawMessage `json:"args,omitempty"`
+	UniqueID string                     `json:"_unique_id"`
+	MsgID    string                     `json:"_msg_id,omitempty"`
+	ReplyQ   string                     `json:"_reply_q,omitempty"`
+	Result   json.RawMessage            `json:"result,omitempty"`
+	Failure  json.RawMessage            `json:"failure,omitempty"`
+	Ending   bool                       `json:"ending,omitempty"`
+}
+
+func (o *OSLO) InitBus(config interface{}) error {
+	if err := decodeConfig(config, &o.config); err != nil {
+		return err
+	}
+	if len(o.config.Exchange) == 0 {
+		o.config.Exchange = "openstack"
+	}
+	if len(o.config.Method) == 0 {
+		o.config.Method = "ari_message"
+	}
+	o.consumers = make(map[chan []byte]*osloConsumer)
+	o.responders = make(map[chan *BusRequest]*osloConsumer)
+	o.replies = make(map[string]chan *osloMessage)
+	return o.bus.InitBus(o.config.RabbitMQConfig)
+}
+
+// RemoteError is the exception raised by the method of a call, as reported by
+// the failure of its reply.
+type RemoteError struct {
+	Class   string `json:"class"`
+	Module  string `json:"module"`
+	Message string `json:"message"`
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("Remote error: %s.%s: %s", e.Module, e.Class, e.Message)
+}
+
+// remoteError decodes the failure of a reply, a JSON object serialized as a
+// JSON string by oslo.messaging.
+func remoteError(failure json.RawMessage) *RemoteError {
+	var serialized string
+	if json.Unmarshal(failure, &serialized) == nil {
+		failure = json.RawMessage(serialized)
+	}
+	e := &RemoteError{}
+	if json.Unmarshal(failure, e) != nil {
+		e.Message = string(failure)
+	}
+	return e
+}
+
+// isNull reports whether a JSON value is missing or null.
+func isNull(value json.RawMessage) bool {
+	return len(value) == 0 || string(value) == "null"
+}
+
+// rawJSON returns a message as a JSON value: itself when it is JSON, and a
+// JSON string otherwise.
+func rawJSON(message []byte) json.RawMessage {
+	if json.Valid(message) {
+		return json.RawMessage(message)
+	}
+	encoded, _ := json.Marshal(string(message))
+	return encoded
+}
+
+// wrap puts a message in the envelope of oslo.messaging.
+func wrap(m *osloMessage) ([]byte, error) {
+	m.UniqueID = UUID()
+	inner, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(osloEnvelope{Version: osloVersion, Message: string(inner)})
+}
+
+// unwrap extracts a message from the envelope of oslo.messaging, or parses it
+// as is when it has none, as sent by the first version of the protocol.
+func unwrap(body []byte) (*osloMessage, error) {
+	var envelope osloEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	if len(envelope.Version) > 0 {
+		body = []byte(envelope.Message)
+	}
+	var m osloMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// cast creates the cast or call of a message published to a topic. A message
+// which is JSON is the message argument as is; any other message is the text
+// argument, as a JSON string.
+func (o *OSLO) cast(topic string, message []byte) *osloMessage {
+	encodedTopic, _ := json.Marshal(topic)
+	m := &osloMessage{
+		Method: o.config.Method,
+		Args:   map[string]json.RawMessage{"topic": encodedTopic},
+	}
+	if json.Valid(message) {
+		m.Args["message"] = json.RawMessage(message)
+	} else {
+		m.Args["text"] = rawJSON(message)
+	}
+	return m
+}
+
+// body returns the message carried by a cast or call.
+func (m *osloMessage) body() []byte {
+	if message, ok := m.Args["message"]; ok {
+		return message
+	}
+	if text, ok := m.Args["text"]; ok {
+		var s string
+		json.Unmarshal(text, &s)
+		return []byte(s)
+	}
+	args, _ := json.Marshal(m.Args)
+	return args
+}
+
+func (o *OSLO) StartProducer(topic string) (chan []byte, error) {
+	raw, err := o.bus.StartProducer(topic)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan []byte)
+	go func(messages chan []byte) {
+		defer close(raw)
+		for message := range messages {
+			wrapped, err := wrap(o.cast(topic, message))
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			raw <- wrapped
+		}
+	}(c)
+	return c, nil
+}
+
+func (o *OSLO) StartConsumer(topic string) (chan []byte, error) {
+	c := make(chan []byte)
+	consumer, err := o.consume(topic, func(m *osloMessage, done chan struct{}) {
+		select {
+		case c <- m.body():
+		case <-done:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.lock.Lock()
+	o.consumers[c] = consumer
+	o.lock.Unlock()
+	return c, nil
+}
+
+// consume starts a RabbitMQ consumer of a topic and hands the messages it
+// receives to the handler, unwrapped.
+func (o *OSLO) consume(topic string, handler func(m *osloMessage, done chan struct{})) (*osloConsumer, error) {
+	raw, err := o.bus.StartConsumer(topic)
+	if err != nil {
+		return nil, err
+	}
+	c := &osloConsumer{raw: raw, done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case body := <-raw:
+				m, err := unwrap(body)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				handler(m, c.done)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// stop stops the RabbitMQ consumer.
+func (c *osloConsumer) stop(bus *RabbitMQ) error {
+	close(c.done)
+	return bus.StopConsumer(c.raw)
+}
+
+func (o *OSLO) StopConsumer(consumer chan []byte) error {
+	o.lock.Lock()
+	c, ok := o.consumers[consumer]
+	delete(o.consumers, consumer)
+	o.lock.Unlock()
+	if !ok {
+		return errors.New("Not a consumer of this bus.")
+	}
+	return c.stop(&o.bus)
+}
+
+func (o *OSLO) TopicExists(topic string) bool {
+	return o.bus.TopicExists(topic)
+}
+
+// publish publishes a message on a channel of its own.
+func (o *OSLO) publish(exchange string, key string, body []byte) error {
+	o.bus.lock.Lock()
+	channel, err := o.bus.producerConn.Channel()
+	o.bus.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+	return channel.Publish(exchange, key, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		Body:         body,
+		DeliveryMode: o.bus.config.DeliveryMode,
+	})
+}
+
+// startReplies declares the reply queue of the bus, bound to the direct
+// exchange of the same name, and starts routing the replies it receives to
+// the pending calls. Must be called with the lock held.
+func (o *OSLO) startReplies() error {
+	if len(o.replyQueue) > 0 {
+		return nil
+	}
+	name := "reply_" + UUID()
+	o.bus.lock.Lock()
+	channel, err := o.bus.consumerConn.Channel()
+	o.bus.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	err = channel.ExchangeDeclare(name, "direct", false, true, false, false, nil)
+	if err == nil {
+		_, err = channel.QueueDeclare(name, false, true, true, false, nil)
+	}
+	if err == nil {
+		err = channel.QueueBind(name, name, name, false, nil)
+	}
+	var deliveries <-chan amqp.Delivery
+	if err == nil {
+		deliveries, err = channel.Consume(name, "", true, true, false, false, nil)
+	}
+	if err != nil {
+		channel.Close()
+		return err
+	}
+	o.replyQueue = name
+	go func() {
+		for d := range deliveries {
+			o.deliver(d.Body)
+		}
+		// The connection was lost: declare a new queue on the next call.
+		o.lock.Lock()
+		if o.replyQueue == name {
+			o.replyQueue = ""
+		}
+		o.lock.Unlock()
+	}()
+	return nil
+}
+
+// deliver hands a reply to the pending call it answers. oslo.messaging 2
+// answers a call with a single reply, ending it, even when the method returned
+// nothing; older versions send the result without ending the call, then an
+// empty ending message. Either way the first reply to a call carries its
+// outcome, and the call stops waiting for more.
+func (o *OSLO) deliver(body []byte) {
+	m, err := unwrap(body)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	o.lock.Lock()
+	reply, ok := o.replies[m.MsgID]
+	delete(o.replies, m.MsgID)
+	o.lock.Unlock()
+	if ok {
+		reply <- m
+	}
+}
+
+// awaitReply waits for the reply to a call, and returns its result or failure.
+func awaitReply(ctx context.Context, reply chan *osloMessage) ([]byte, error) {
+	select {
+	case m := <-reply:
+		if !isNull(m.Failure) {
+			return nil, remoteError(m.Failure)
+		}
+		if len(m.Result) == 0 {
+			return []byte("null"), nil
+		}
+		return m.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Request makes a call, and returns its result as JSON; a reply which is not
+// JSON is returned as a JSON string. The failure of the call is returned as a
+// *RemoteError.
+func (o *OSLO) Request(ctx context.Context, topic string, request []byte) ([]byte, error) {
+	call := o.cast(topic, request)
+	call.MsgID = UUID()
+	reply := make(chan *osloMessage, 1)
+	o.lock.Lock()
+	err := o.startReplies()
+	call.ReplyQ = o.replyQueue
+	o.replies[call.MsgID] = reply
+	o.lock.Unlock()
+	defer func() {
+		o.lock.Lock()
+		delete(o.replies, call.MsgID)
+		o.lock.Unlock()
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := wrap(call)
+	if err != nil {
+		return nil, err
+	}
+	exchange, key := o.bus.destination(topic)
+	if err = o.publish(exchange, key, wrapped); err != nil {
+		return nil, err
+	}
+	return awaitReply(ctx, reply)
+}
+
+func (o *OSLO) StartResponder(topic string) (chan *BusRequest, error) {
+	c := make(chan *BusRequest)
+	responder, err := o.consume(topic, func(m *osloMessage, done chan struct{}) {
+		if len(m.MsgID) == 0 {
+			return // a cast
+		}
+		request := NewBusRequest(m.body(), func(response []byte) error {
+			wrapped, err := wrap(&osloMessage{MsgID: m.MsgID, Result: rawJSON(response), Ending: true})
+			if err != nil {
+				return err
+			}
+			return o.publish(m.ReplyQ, m.ReplyQ, wrapped)
+		})
+		select {
+		case c <- request:
+		case <-done:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	o.lock.Lock()
+	o.responders[c] = responder
+	o.lock.Unlock()
+	return c, nil
+}
+
+func (o *OSLO) StopResponder(responder chan *BusRequest) error {
+	o.lock.Lock()
+	c, ok := o.responders[responder]
+	delete(o.responders, responder)
+	o.lock.Unlock()
+	if !ok {
+		return errors.New("Not a responder of this bus.")
+	}
+	return c.stop(&o.bus)
+}
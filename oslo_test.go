@@ -0,0 +1,91 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOSLOBody(t *testing.T) {
+	o := &OSLO{config: OSLOConfig{Method: "ari_message"}}
+	for _, message := range []string{`{"a":1}`, `"abc"`, `abc`, `12`} {
+		wrapped, err := wrap(o.cast("events_d1", []byte(message)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := unwrap(wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m.body()) != message {
+			t.Errorf("got %s, want %s", m.body(), message)
+		}
+	}
+	// Casts of OpenStack services carry their arguments.
+	m, _ := unwrap([]byte(`{"method":"foo","args":{"x":2}}`))
+	if string(m.body()) != `{"x":2}` {
+		t.Errorf("got %s", m.body())
+	}
+}
+
+// call registers a pending call, delivers the replies to it and returns what
+// Request returns once they arrived.
+func call(replies ...string) ([]byte, error) {
+	o := &OSLO{replies: make(map[string]chan *osloMessage)}
+	reply := make(chan *osloMessage, 1)
+	o.replies["1"] = reply
+	for _, r := range replies {
+		o.deliver([]byte(r))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	return awaitReply(ctx, reply)
+}
+
+func TestOSLORemoteError(t *testing.T) {
+	failure := `"{\"class\": \"ValueError\", \"module\": \"builtins\", \"message\": \"bad\", \"tb\": []}"`
+	_, err := call(`{"oslo.version":"2.0","oslo.message":` + quote(`{"_msg_id":"1","failure":`+failure+`,"ending":true}`) + `}`)
+	e, ok := err.(*RemoteError)
+	if !ok {
+		t.Fatalf("got %v, want a *RemoteError", err)
+	}
+	if e.Class != "ValueError" || e.Module != "builtins" || e.Message != "bad" {
+		t.Errorf("got %+v", e)
+	}
+	if e.Error() != "Remote error: builtins.ValueError: bad" {
+		t.Errorf("got %s", e)
+	}
+}
+
+func TestOSLOResult(t *testing.T) {
+	tests := []struct {
+		replies []string
+		want    string
+	}{
+		// oslo.messaging 2 sends a single reply, also for methods returning None.
+		{[]string{`{"_msg_id":"1","result":{"a":1},"failure":null,"ending":true}`}, `{"a":1}`},
+		{[]string{`{"_msg_id":"1","result":null,"failure":null,"ending":true}`}, `null`},
+		{[]string{`{"_msg_id":"1","failure":null,"ending":true}`}, `null`},
+		// Older versions send the result, then an empty ending message.
+		{[]string{`{"_msg_id":"1","result":"x","failure":null}`, `{"_msg_id":"1","result":null,"failure":null,"ending":true}`}, `"x"`},
+		{[]string{`{"_msg_id":"1","result":null,"failure":null}`, `{"_msg_id":"1","result":null,"failure":null,"ending":true}`}, `null`},
+		// Replies to other calls are ignored.
+		{[]string{`{"_msg_id":"2","result":2,"ending":true}`, `{"_msg_id":"1","result":1,"ending":true}`}, `1`},
+	}
+	for _, tt := range tests {
+		result, err := call(tt.replies...)
+		if err != nil || string(result) != tt.want {
+			t.Errorf("%v: got %s, %v, want %s", tt.replies, result, err, tt.want)
+		}
+	}
+	if _, err := call(); err != context.DeadlineExceeded {
+		t.Errorf("Without a reply got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// quote encodes a string as JSON.
+func quote(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
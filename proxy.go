@@ -0,0 +1,45 @@
+package ari
+
+// Proxy is the server half of the protocol: it connects the ARI of an
+// Asterisk server to the message bus of a Client. For each channel entering
+// one of its applications it publishes AppStart on the topic of the
+// application, then routes the events of the channel, and of the channels,
+// bridges, playbacks and recordings the dialog creates, to the EventsTopic of
+// the dialog and executes the commands received on its CommandsTopic against
+// ARI, replying with the CommandResponse bearing the UniqueID of the Command.
+type Proxy struct {
+	client *Client
+	router *router
+}
+
+// NewProxy creates a proxy between the Asterisk server and the message bus of
+// the client.
+func (c *Client) NewProxy(config AsteriskConfig) *Proxy {
+	return &Proxy{client: c, router: newRouter(config, c.bus)}
+}
+
+// NewProxy creates a proxy using the bus of the DefaultClient, which must have
+// been set up by InitBus.
+func NewProxy(config AsteriskConfig) *Proxy {
+	return DefaultClient.NewProxy(config)
+}
+
+// Serve starts reading the events of the applications from the ARI
+// WebSocket. Connections lost are reestablished until Stop is called.
+func (p *Proxy) Serve(apps ...string) {
+	for _, app := range apps {
+		p.router.startApp(app)
+	}
+}
+
+// Stop stops reading the events of the applications, or of all of them when
+// none is given. Their dialogs in progress end: the proxy stops publishing
+// their events and answering their commands.
+func (p *Proxy) Stop(apps ...string) {
+	if len(apps) == 0 {
+		apps = p.router.running()
+	}
+	for _, app := range apps {
+		p.router.stopApp(app)
+	}
+}
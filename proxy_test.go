@@ -0,0 +1,221 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestRouter creates a router between a fake ARI, which answers POST
+// /channels with the channel out1 and other requests with 204 No Content, and
+// a Memory bus. The router reads the events of the application vm, which are
+// routed by the tests rather than sent on the WebSocket. The requests ARI
+// received are sent on the returned channel.
+func newTestRouter(t *testing.T) (*router, MessageBus, chan string) {
+	requests := make(chan string, 16)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ari/events" {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		requests <- r.Method + " " + r.URL.Path
+		if r.Method == "POST" && r.URL.Path == "/ari/channels" {
+			w.Write([]byte(`{"id":"out1"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	bus := &Memory{}
+	bus.InitBus(MemoryConfig{Broker: "test-" + UUID()})
+	r := newRouter(AsteriskConfig{URL: server.URL + "/ari", Username: "u", Password: "p", StartTimeout: Duration(time.Second)}, bus)
+	r.startApp("vm")
+	t.Cleanup(func() {
+		r.stopApp("vm")
+		server.Close()
+	})
+	return r, bus, requests
+}
+
+// ariMessage returns an ARI event of the application vm about a channel.
+func ariMessage(eventType string, channelID string) []byte {
+	return []byte(`{"type":"` + eventType + `","timestamp":"2015-01-01T00:00:00.000+0000","asterisk_id":"ast1","application":"vm","channel":{"id":"` + channelID + `"}}`)
+}
+
+// receive returns the next message of a consumer.
+func receive(t *testing.T, consumer chan []byte) []byte {
+	select {
+	case message := <-consumer:
+		return message
+	case <-time.After(3 * time.Second):
+		t.Fatal("No message received")
+	}
+	return nil
+}
+
+// startTestDialog routes the StasisStart of the channel in1, and returns the
+// dialog started along with a consumer of its events.
+func startTestDialog(t *testing.T, r *router, bus MessageBus) (string, chan []byte) {
+	starts, _ := bus.StartConsumer("vm")
+	defer bus.StopConsumer(starts)
+	r.route("vm", ariMessage("StasisStart", "in1"))
+	var start AppStart
+	json.Unmarshal(receive(t, starts), &start)
+	if start.Application != "vm" || start.ServerID != "ast1" {
+		t.Fatalf("AppStart is %+v", start)
+	}
+	events, _ := bus.StartConsumer(EventsTopic(start.DialogID))
+	t.Cleanup(func() { bus.StopConsumer(events) })
+	return start.DialogID, events
+}
+
+// command sends a command of a dialog and returns the response.
+func command(bus MessageBus, dialogID string, method string, url string, body string) (*CommandResponse, error) {
+	request, _ := json.Marshal(Command{UniqueID: UUID(), Method: method, URL: url, Body: body})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := bus.Request(ctx, CommandsTopic(dialogID), request)
+	if err != nil {
+		return nil, err
+	}
+	var response CommandResponse
+	err = json.Unmarshal(reply, &response)
+	return &response, err
+}
+
+func TestRouterDialog(t *testing.T) {
+	r, bus, requests := newTestRouter(t)
+	dialogID, events := startTestDialog(t, r, bus)
+	var e Event
+	json.Unmarshal(receive(t, events), &e)
+	if e.Type != "StasisStart" || e.ServerID != "ast1" {
+		t.Errorf("Event is %+v, want the StasisStart of ast1", e)
+	}
+
+	response, err := command(bus, dialogID, "POST", "/channels", `{"endpoint":"SIP/out"}`)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("Originate answered %+v, %v", response, err)
+	}
+	if request := <-requests; request != "POST /ari/channels" {
+		t.Errorf("ARI received %s, want POST /ari/channels", request)
+	}
+	// The originated channel belongs to the dialog.
+	r.route("vm", ariMessage("StasisStart", "out1"))
+	json.Unmarshal(receive(t, events), &e)
+	if e.Type != "StasisStart" {
+		t.Errorf("Event is %s, want StasisStart", e.Type)
+	}
+
+	r.route("vm", ariMessage("StasisEnd", "in1"))
+	receive(t, events)
+	if _, err := command(bus, dialogID, "POST", "/channels/out1/answer", ``); err != nil {
+		t.Errorf("Answer failed with one channel left: %v", err)
+	}
+	r.route("vm", ariMessage("StasisEnd", "out1"))
+	receive(t, events)
+	if _, ok := r.registry.Lookup("channel:out1"); ok {
+		t.Error("Channel of an ended dialog still routed")
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for bus.TopicExists(CommandsTopic(dialogID)) {
+		if time.Now().After(deadline) {
+			t.Fatal("Commands of an ended dialog still answered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRouterStopApp(t *testing.T) {
+	r, bus, _ := newTestRouter(t)
+	dialogID, events := startTestDialog(t, r, bus)
+	receive(t, events)
+
+	(&Proxy{router: r}).Stop()
+	r.lock.Lock()
+	dialogs := len(r.dialogs)
+	r.lock.Unlock()
+	if dialogs != 0 {
+		t.Errorf("%d dialogs after Stop, want 0", dialogs)
+	}
+	if _, ok := r.registry.Lookup("channel:in1"); ok {
+		t.Error("Channel of a stopped application still routed")
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for bus.TopicExists(CommandsTopic(dialogID)) {
+		if time.Now().After(deadline) {
+			t.Fatal("Commands of a stopped application still answered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Events read while stopping start no dialog.
+	starts, _ := bus.StartConsumer("vm")
+	defer bus.StopConsumer(starts)
+	r.route("vm", ariMessage("StasisStart", "in2"))
+	select {
+	case message := <-starts:
+		t.Errorf("Stopped application started a dialog: %s", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRouterAssignsIDs(t *testing.T) {
+	r, bus, _ := newTestRouter(t)
+	dialogID, events := startTestDialog(t, r, bus)
+	receive(t, events)
+
+	// Objects are known before ARI answers, or sends their events.
+	if _, err := command(bus, dialogID, "POST", "/bridges", `{"type":"mixing"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := command(bus, dialogID, "POST", "/channels/in1/play", `{"media":"sound:hello"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := command(bus, dialogID, "POST", "/channels/in1/snoop", `{"app":"vm","snoopId":"s1"}`); err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]int)
+	r.registry.lock.Lock()
+	for object, d := range r.registry.objects {
+		if d == dialogID {
+			kinds[object[:strings.Index(object, ":")]]++
+		}
+	}
+	r.registry.lock.Unlock()
+	if kinds["bridge"] != 1 || kinds["playback"] != 1 {
+		t.Errorf("Dialog has %v, want a bridge and a playback", kinds)
+	}
+	if _, ok := r.registry.Lookup("channel:s1"); !ok {
+		t.Error("Snoop channel with its ID chosen by the instance not routed")
+	}
+}
+
+func TestAsteriskAppConsumers(t *testing.T) {
+	a := &Asterisk{}
+	if err := a.InitBus(AsteriskConfig{URL: "http://127.0.0.1:1/ari"}); err != nil {
+		t.Fatal(err)
+	}
+	c1, _ := a.StartConsumer("vm")
+	c2, _ := a.StartConsumer("vm")
+	a.StopConsumer(c1)
+	if running := a.router.running(); len(running) != 1 {
+		t.Errorf("Applications read with a consumer left: %v, want [vm]", running)
+	}
+	a.StopConsumer(c2)
+	if running := a.router.running(); len(running) != 0 {
+		t.Errorf("Applications read without consumers: %v", running)
+	}
+}
@@ -1,27 +1,71 @@
 package ari
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/streadway/amqp"
 )
 
-type rabbitmqConfig struct {
-	URL string `json:"url"`
+// RabbitMQConfig is the configuration of the RabbitMQ message bus.
+// Messages are published to a topic exchange, with routing keys derived from
+// the topics, and received from queues bound to it. The queues of application
+// instances are deleted with their consumer; messages published to a topic
+// without queue are dropped. DurableQueues selects the behavior of earlier
+// versions instead: one durable queue per topic on the default exchange.
+// When the connection to the broker is lost, the bus reconnects with an
+// exponential backoff, declares the queues again and rebinds its producers and
+// consumers. Messages sent to a producer meanwhile are buffered.
+type RabbitMQConfig struct {
+	URL              string                `json:"url"`
+	ReconnectWait    Duration              `json:"reconnect_wait"`     // delay before the first reconnection attempt, doubled after each failure
+	MaxReconnectWait Duration              `json:"max_reconnect_wait"` // longest delay between reconnection attempts
+	MaxReconnect     int                   `json:"max_reconnect"`      // attempts before giving up; 0 means never give up
+	PublishBuffer    int                   `json:"publish_buffer"`     // messages buffered per producer while disconnected
+	Exchange         string                `json:"exchange"`           // topic exchange of the bus; "ari" by default
+	RoutingKeys      map[string]string     `json:"routing_keys"`       // routing key of each topic, overriding the derived ones
+	MessageTTL       Duration              `json:"message_ttl"`        // time after which messages to application instances expire; never if 0
+	DurableQueues    bool                  `json:"durable_queues"`     // one durable queue per topic on the default exchange
+	DeliveryMode     uint8                 `json:"delivery_mode"`      // amqp.Transient (default) or amqp.Persistent
+	Prefetch         int                   `json:"prefetch"`           // unacknowledged messages per consumer; unlimited if 0
+	DeadLetter       string                `json:"dead_letter"`        // exchange and queue receiving the rejected messages, if any
+	OnStateChange    func(ConnectionState) `json:"-"`
 }
+
 type RabbitMQ struct {
-	config       rabbitmqConfig
+	config       RabbitMQConfig
+	lock         sync.Mutex
 	producerConn *amqp.Connection
 	consumerConn *amqp.Connection
+	producers    map[chan []byte]*RabbitMQProducer
+	consumers    map[*RabbitMQConsumer]bool
 }
 
 func (r *RabbitMQ) InitBus(config interface{}) error {
 	var err error
-	c := config.(map[string]interface{})
-	for key, value := range c {
-		switch key {
-		case "url":
-			r.config.URL = value.(string)
-		}
+	if err = decodeConfig(config, &r.config); err != nil {
+		return err
+	}
+	if r.config.ReconnectWait <= 0 {
+		r.config.ReconnectWait = Duration(time.Second)
+	}
+	if r.config.MaxReconnectWait <= 0 {
+		r.config.MaxReconnectWait = Duration(30 * time.Second)
 	}
+	if len(r.config.Exchange) == 0 {
+		r.config.Exchange = "ari"
+	}
+	if r.config.DeliveryMode == 0 {
+		r.config.DeliveryMode = amqp.Transient
+	}
+	if r.config.PublishBuffer <= 0 {
+		r.config.PublishBuffer = 1000
+	}
+	r.producers = make(map[chan []byte]*RabbitMQProducer)
+	r.consumers = make(map[*RabbitMQConsumer]bool)
 
 	r.producerConn, err = amqp.Dial(r.config.URL)
 	if err != nil {
@@ -29,76 +73,657 @@ func (r *RabbitMQ) InitBus(config interface{}) error {
 	}
 	r.consumerConn, err = amqp.Dial(r.config.URL)
 	if err != nil {
+		r.producerConn.Close()
 		return err
 	}
+	go r.watch(r.producerConn, true)
+	go r.watch(r.consumerConn, false)
 	return nil
 }
 
+// notify reports a change of the state of the connection.
+func (r *RabbitMQ) notify(state ConnectionState) {
+	if r.config.OnStateChange != nil {
+		r.config.OnStateChange(state)
+	}
+}
+
+// watch waits for a connection to be lost, then replaces it and rebinds the
+// producers or consumers using it.
+func (r *RabbitMQ) watch(conn *amqp.Connection, producers bool) {
+	if amqpErr := <-conn.NotifyClose(make(chan *amqp.Error, 1)); amqpErr == nil {
+		return // closed on purpose
+	}
+	r.notify(Disconnected)
+	conn, err := r.redial()
+	if err != nil {
+		fmt.Println(err)
+		r.notify(ConnectionClosed)
+		return
+	}
+
+	r.lock.Lock()
+	if producers {
+		r.producerConn = conn
+		for _, p := range r.producers {
+			p.channel = nil
+			select {
+			case p.reconnected <- struct{}{}:
+			default:
+			}
+		}
+	} else {
+		r.consumerConn = conn
+		for c := range r.consumers {
+			if err := r.openConsumer(c); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+	r.lock.Unlock()
+	r.notify(Reconnected)
+	go r.watch(conn, producers)
+}
+
+// redial connects to the broker again, waiting longer after each failure.
+func (r *RabbitMQ) redial() (*amqp.Connection, error) {
+	wait := time.Duration(r.config.ReconnectWait)
+	for attempt := 1; ; attempt++ {
+		time.Sleep(wait)
+		conn, err := amqp.Dial(r.config.URL)
+		if err == nil {
+			return conn, nil
+		}
+		if r.config.MaxReconnect > 0 && attempt >= r.config.MaxReconnect {
+			return nil, err
+		}
+		wait *= 2
+		if max := time.Duration(r.config.MaxReconnectWait); wait > max {
+			wait = max
+		}
+	}
+}
+
+// declareExchange declares the topic exchange of the bus.
+func (r *RabbitMQ) declareExchange(channel *amqp.Channel) error {
+	if r.config.DurableQueues {
+		return nil // the default exchange
+	}
+	return channel.ExchangeDeclare(
+		r.config.Exchange, // name of exchange
+		"topic",           // type
+		true,              // durable
+		false,             // delete when unused
+		false,             // internal
+		false,             // nowait
+		nil)               // arguments
+}
+
+// declareQueue declares the queue of a topic and binds it to the exchange with
+// the routing key of the topic. The queues of the topics of an application
+// instance are exclusive to their consumer and deleted with it, and their
+// messages expire after MessageTTL; those of applications are durable and
+// shared by their consumers.
+func (r *RabbitMQ) declareQueue(channel *amqp.Channel, topic string) (amqp.Queue, error) {
+	arguments := amqp.Table{}
+	if len(r.config.DeadLetter) > 0 {
+		if err := r.declareDeadLetter(channel); err != nil {
+			return amqp.Queue{}, err
+		}
+		arguments["x-dead-letter-exchange"] = r.config.DeadLetter
+	}
+	if r.config.DurableQueues {
+		return channel.QueueDeclare(topic, true, false, false, false, arguments)
+	}
+	if err := r.declareExchange(channel); err != nil {
+		return amqp.Queue{}, err
+	}
+	instance := false
+	if _, _, ok := splitInstanceTopic(topic); ok {
+		instance = true
+		if r.config.MessageTTL > 0 {
+			arguments["x-message-ttl"] = int64(time.Duration(r.config.MessageTTL) / time.Millisecond)
+		}
+	}
+	queue, err := channel.QueueDeclare(
+		topic,     // name of queue
+		!instance, // durable
+		instance,  // delete when unused
+		instance,  // exclusive
+		false,     // nowait
+		arguments) // arguments
+	if err != nil {
+		return queue, err
+	}
+	return queue, channel.QueueBind(queue.Name, r.routingKey(topic), r.config.Exchange, false, nil)
+}
+
+// declareDeadLetter declares the exchange to which rejected messages are
+// dead-lettered, and a queue keeping them.
+func (r *RabbitMQ) declareDeadLetter(channel *amqp.Channel) error {
+	name := r.config.DeadLetter
+	if err := channel.ExchangeDeclare(name, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := channel.QueueDeclare(name, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return channel.QueueBind(name, "", name, false, nil)
+}
+
+// routingKey returns the routing key of the messages published to a topic:
+// e.g. "events.<dialog ID>" for the events topic of an application instance,
+// and the name of the topic for the others.
+func (r *RabbitMQ) routingKey(topic string) string {
+	if key, ok := r.config.RoutingKeys[topic]; ok {
+		return key
+	}
+	if kind, dialogID, ok := splitInstanceTopic(topic); ok {
+		return kind + "." + dialogID
+	}
+	return topic
+}
+
+// destination returns the exchange and routing key of the messages published
+// to a topic.
+func (r *RabbitMQ) destination(topic string) (exchange string, key string) {
+	if r.config.DurableQueues {
+		return "", topic
+	}
+	return r.config.Exchange, r.routingKey(topic)
+}
+
+// PublishError reports a message the RabbitMQ message bus failed to publish.
+type PublishError struct {
+	Topic   string
+	Message []byte
+	Err     error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("Unable to publish to %s: %s", e.Topic, e.Err)
+}
+
+// RabbitMQProducer is a producer of the RabbitMQ message bus. Each message is
+// published with publisher confirms; the messages the broker rejects or which
+// are dropped are reported on the Errors channel.
+type RabbitMQProducer struct {
+	topic       string
+	messages    chan []byte
+	errors      chan error
+	channel     *amqp.Channel // nil until (re)opened
+	confirms    chan amqp.Confirmation
+	reconnected chan struct{}
+	buffer      [][]byte
+	closeOnce   sync.Once
+	done        chan struct{}
+	err         error
+}
+
 func (r *RabbitMQ) StartProducer(topic string) (chan []byte, error) {
-	c := make(chan []byte)
-	channel, err := r.producerConn.Channel()
-	_, err = channel.QueueDeclare(
-		topic, // name of queue
-		true,  // durable
-		false, // delete when unused
-		false, // exclusive
-		true,  // nowait
-		nil)   // arguments
-
-	go func(channel *amqp.Channel, messages chan []byte) {
-		for message := range messages {
-			channel.Publish(
-				"", // exchange, for now always using the default exchange
-				topic,
-				false,
-				false,
-				amqp.Publishing{
-					Headers:         amqp.Table{},
-					ContentType:     "application/json",
-					ContentEncoding: "",
-					Body:            message,
-					DeliveryMode:    amqp.Transient, // 1=non-persistent, 2=persistent
-					Priority:        0,              // 0-9
-				})
-		}
-	}(channel, c)
+	p, err := r.NewProducer(topic)
 	if err != nil {
 		return nil, err
 	}
-	return c, nil
+	return p.messages, nil
 }
 
-func (r *RabbitMQ) StartConsumer(topic string) (chan []byte, error) {
-	c := make(chan []byte)
-	channel, err := r.consumerConn.Channel()
+// NewProducer starts a producer for a topic. Unlike StartProducer, it returns
+// a handle reporting the failed publishes.
+func (r *RabbitMQ) NewProducer(topic string) (*RabbitMQProducer, error) {
+	p := &RabbitMQProducer{
+		topic:       topic,
+		messages:    make(chan []byte),
+		errors:      make(chan error, 16),
+		reconnected: make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	r.lock.Lock()
+	err := r.openProducer(p)
+	if err == nil {
+		r.producers[p.messages] = p
+	}
+	r.lock.Unlock()
 	if err != nil {
 		return nil, err
 	}
-	queue, err := channel.QueueDeclare(
-		topic, // name of queue
-		true,  // durable
-		false, // delete when unused
-		false, // exclusive
-		true,  // nowait
-		nil)   // arguments
+	go r.produce(p)
+	return p, nil
+}
+
+// Messages returns the channel on which to send the messages to publish.
+// Closing it stops the producer, as Close does.
+func (p *RabbitMQProducer) Messages() chan<- []byte {
+	return p.messages
+}
+
+// Errors returns the channel on which the failed publishes are reported as
+// *PublishError. It is closed once the producer is closed. Errors are dropped
+// when the channel is full.
+func (p *RabbitMQProducer) Errors() <-chan error {
+	return p.errors
+}
+
+// Close stops the producer once the messages sent so far are published, and
+// reports if some of them could not be.
+func (p *RabbitMQProducer) Close() error {
+	p.closeOnce.Do(func() {
+		// The channel of Messages may have been closed by the caller already.
+		defer func() { recover() }()
+		close(p.messages)
+	})
+	<-p.done
+	return p.err
+}
+
+// report reports a failed publish on the Errors channel.
+func (p *RabbitMQProducer) report(message []byte, err error) {
+	select {
+	case p.errors <- &PublishError{Topic: p.topic, Message: message, Err: err}:
+	default:
+		fmt.Println(err)
+	}
+}
 
+// openProducer opens the AMQP channel of a producer in confirm mode and
+// declares the exchange, or its queue when using durable queues. Must be
+// called with the lock held.
+func (r *RabbitMQ) openProducer(p *RabbitMQProducer) error {
+	channel, err := r.producerConn.Channel()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if r.config.DurableQueues {
+		_, err = r.declareQueue(channel, p.topic)
+	} else {
+		err = r.declareExchange(channel)
 	}
-	deliveries, err := channel.Consume(queue.Name, "", false, false, true, true, nil)
 	if err != nil {
+		channel.Close()
+		return err
+	}
+	if err = channel.Confirm(false); err != nil {
+		channel.Close()
+		return err
+	}
+	p.confirms = channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	p.channel = channel
+	return nil
+}
+
+// produce buffers the messages sent to a producer and publishes them whenever
+// the bus is connected.
+func (r *RabbitMQ) produce(p *RabbitMQProducer) {
+	defer close(p.done)
+	for {
+		select {
+		case message, ok := <-p.messages:
+			if !ok {
+				r.flush(p)
+				r.lock.Lock()
+				delete(r.producers, p.messages)
+				if p.channel != nil {
+					p.channel.Close()
+				}
+				r.lock.Unlock()
+				if len(p.buffer) > 0 {
+					p.err = fmt.Errorf("%d messages to %s could not be published.", len(p.buffer), p.topic)
+				}
+				close(p.errors)
+				return
+			}
+			p.buffer = append(p.buffer, message)
+			if len(p.buffer) > r.config.PublishBuffer {
+				p.report(p.buffer[0], errors.New("Publish buffer full, message dropped."))
+				p.buffer = p.buffer[1:]
+			}
+		case <-p.reconnected:
+		}
+		r.flush(p)
+	}
+}
+
+// flush publishes the buffered messages of a producer, reopening its AMQP
+// channel if needed, and waits for the broker to confirm each of them.
+// Messages that could not be published for want of a connection stay
+// buffered; those the broker rejects are reported.
+func (r *RabbitMQ) flush(p *RabbitMQProducer) {
+	for len(p.buffer) > 0 {
+		r.lock.Lock()
+		if p.channel == nil {
+			if err := r.openProducer(p); err != nil {
+				r.lock.Unlock()
+				return // wait for the connection to be restored
+			}
+		}
+		channel, confirms := p.channel, p.confirms
+		r.lock.Unlock()
+
+		exchange, key := r.destination(p.topic)
+		err := channel.Publish(
+			exchange,
+			key,
+			false,
+			false,
+			amqp.Publishing{
+				Headers:         amqp.Table{},
+				ContentType:     "application/json",
+				ContentEncoding: "",
+				Body:            p.buffer[0],
+				DeliveryMode:    r.config.DeliveryMode, // 1=non-persistent, 2=persistent
+				Priority:        0,                     // 0-9
+			})
+		confirm, ok := amqp.Confirmation{}, false
+		if err == nil {
+			confirm, ok = <-confirms
+		}
+		if err != nil || !ok {
+			// the channel or the connection was closed
+			r.lock.Lock()
+			if p.channel == channel {
+				p.channel = nil
+			}
+			r.lock.Unlock()
+			return
+		}
+		if !confirm.Ack {
+			p.report(p.buffer[0], errors.New("Message rejected by the broker."))
+		}
+		p.buffer = p.buffer[1:]
+	}
+}
+
+func (r *RabbitMQ) StartConsumer(topic string) (chan []byte, error) {
+	c := &RabbitMQConsumer{
+		topic: topic,
+		out:   make(chan []byte),
+		done:  make(chan struct{}),
+	}
+	if err := r.startConsumer(c); err != nil {
 		return nil, err
 	}
-	go func(deliveries <-chan amqp.Delivery, c chan []byte) {
+	return c.out, nil
+}
+
+// RabbitMQConsumer is a consumer of the RabbitMQ message bus. The messages of
+// the consumers started by StartConsumer are acknowledged once received, those
+// of the consumers started by NewConsumer by the application once processed.
+// Messages left unacknowledged when the consumer is closed or the connection
+// is lost are delivered again.
+type RabbitMQConsumer struct {
+	bus        *RabbitMQ
+	topic      string
+	out        chan []byte            // for consumers started by StartConsumer
+	deliveries chan *RabbitMQDelivery // for consumers started by NewConsumer
+	requests   chan *BusRequest       // for responders
+	channel    *amqp.Channel
+	done       chan struct{}
+}
+
+// RabbitMQDelivery is a message received by a RabbitMQConsumer.
+type RabbitMQDelivery struct {
+	Body     []byte
+	delivery amqp.Delivery
+}
+
+// NewConsumer starts a consumer for a topic whose messages must be
+// acknowledged with Ack, or negatively acknowledged with Nack or Fail.
+func (r *RabbitMQ) NewConsumer(topic string) (*RabbitMQConsumer, error) {
+	c := &RabbitMQConsumer{
+		bus:        r,
+		topic:      topic,
+		deliveries: make(chan *RabbitMQDelivery),
+		done:       make(chan struct{}),
+	}
+	if err := r.startConsumer(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Deliveries returns the channel on which the messages are received.
+func (c *RabbitMQConsumer) Deliveries() <-chan *RabbitMQDelivery {
+	return c.deliveries
+}
+
+// Close stops the consumer. The messages not acknowledged yet are requeued.
+func (c *RabbitMQConsumer) Close() error {
+	return c.bus.stopConsumer(c)
+}
+
+// Ack acknowledges the message once processed.
+func (d *RabbitMQDelivery) Ack() error {
+	return d.delivery.Ack(false) // false does *not* mean don't acknowledge, see library docs for details
+}
+
+// Nack negatively acknowledges the message, which is delivered again if
+// requeue is true, and dead-lettered otherwise.
+func (d *RabbitMQDelivery) Nack(requeue bool) error {
+	return d.delivery.Nack(false, requeue)
+}
+
+// Fail negatively acknowledges a message which could not be processed, e.g.
+// decoded. The message is requeued the first time, and dead-lettered if it was
+// already delivered before.
+func (d *RabbitMQDelivery) Fail() error {
+	return d.delivery.Nack(false, !d.delivery.Redelivered)
+}
+
+// startConsumer opens the AMQP channel of a consumer and registers it.
+func (r *RabbitMQ) startConsumer(c *RabbitMQConsumer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err := r.openConsumer(c); err != nil {
+		return err
+	}
+	r.consumers[c] = true
+	return nil
+}
+
+// openConsumer opens the AMQP channel of a consumer, declares its queue and
+// starts forwarding its deliveries. Must be called with the lock held.
+func (r *RabbitMQ) openConsumer(c *RabbitMQConsumer) error {
+	channel, err := r.consumerConn.Channel()
+	if err != nil {
+		return err
+	}
+	if r.config.Prefetch > 0 {
+		if err = channel.Qos(r.config.Prefetch, 0, false); err != nil {
+			channel.Close()
+			return err
+		}
+	}
+	queue, err := r.declareQueue(channel, c.topic)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+	deliveries, err := channel.Consume(queue.Name, "", false, false, true, false, nil)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+	c.channel = channel
+	go func(deliveries <-chan amqp.Delivery, c *RabbitMQConsumer) {
 		for d := range deliveries {
-			c <- d.Body
-			d.Ack(false) // false does *not* mean don't acknowledge, see library docs for details
+			if c.requests != nil {
+				select {
+				case c.requests <- r.busRequest(channel, d):
+				case <-c.done:
+					return
+				}
+				continue
+			}
+			if c.deliveries != nil {
+				select {
+				case c.deliveries <- &RabbitMQDelivery{Body: d.Body, delivery: d}:
+				case <-c.done:
+					return
+				}
+				continue
+			}
+			select {
+			case c.out <- d.Body:
+				d.Ack(false)
+			case <-c.done:
+				return
+			}
 		}
 	}(deliveries, c)
+	return nil
+}
 
-	return c, nil
+func (r *RabbitMQ) StopConsumer(consumer chan []byte) error {
+	r.lock.Lock()
+	var found *RabbitMQConsumer
+	for c := range r.consumers {
+		if c.out != nil && c.out == consumer {
+			found = c
+		}
+	}
+	r.lock.Unlock()
+	if found == nil {
+		return errors.New("Not a consumer of this bus.")
+	}
+	return r.stopConsumer(found)
 }
 
+// stopConsumer unregisters a consumer and closes its AMQP channel.
+func (r *RabbitMQ) stopConsumer(c *RabbitMQConsumer) error {
+	r.lock.Lock()
+	_, ok := r.consumers[c]
+	delete(r.consumers, c)
+	channel := c.channel
+	r.lock.Unlock()
+	if !ok {
+		return nil // already stopped
+	}
+	close(c.done)
+	if err := channel.Close(); err != nil && err != amqp.ErrClosed {
+		return err
+	}
+	return nil // unacknowledged deliveries are requeued
+}
+
+// TopicExists declares the queue of the topic passively, and reports whether
+// it has a consumer. The queue of an application instance being exclusive,
+// the broker refuses to declare it when it exists.
 func (r *RabbitMQ) TopicExists(topic string) bool {
-	return true
+	r.lock.Lock()
+	channel, err := r.consumerConn.Channel()
+	r.lock.Unlock()
+	if err != nil {
+		return false
+	}
+	defer channel.Close()
+	queue, err := channel.QueueDeclarePassive(topic, false, false, false, false, nil)
+	if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.ResourceLocked {
+		return true
+	}
+	return err == nil && queue.Consumers > 0
+}
+
+// directReplyTo is the pseudo-queue on which the replies to requests are
+// received without declaring a queue.
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+// Request publishes the request with the direct reply-to pseudo-queue of a
+// channel of its own as reply_to, and waits for the reply bearing its
+// correlation_id. The broker returns a request no queue receives.
+func (r *RabbitMQ) Request(ctx context.Context, topic string, request []byte) ([]byte, error) {
+	r.lock.Lock()
+	channel, err := r.producerConn.Channel()
+	r.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+	returns := channel.NotifyReturn(make(chan amqp.Return, 1))
+	replies, err := channel.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	correlationID := UUID()
+	exchange, key := r.destination(topic)
+	err = channel.Publish(
+		exchange,
+		key,
+		true, // mandatory
+		false,
+		amqp.Publishing{
+			Headers:       amqp.Table{},
+			ContentType:   "application/json",
+			Body:          request,
+			DeliveryMode:  amqp.Transient,
+			ReplyTo:       directReplyTo,
+			CorrelationId: correlationID,
+		})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case d, ok := <-replies:
+			if !ok {
+				return nil, amqp.ErrClosed
+			}
+			if d.CorrelationId == correlationID {
+				return d.Body, nil
+			}
+		case <-returns:
+			return nil, errors.New("No responder for topic: " + topic)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// busRequest creates the request of a delivery, which is acknowledged once
+// answered.
+func (r *RabbitMQ) busRequest(channel *amqp.Channel, d amqp.Delivery) *BusRequest {
+	return NewBusRequest(d.Body, func(response []byte) error {
+		err := channel.Publish(
+			"",
+			d.ReplyTo,
+			false,
+			false,
+			amqp.Publishing{
+				Headers:       amqp.Table{},
+				ContentType:   "application/json",
+				Body:          response,
+				DeliveryMode:  amqp.Transient,
+				CorrelationId: d.CorrelationId,
+			})
+		if err != nil {
+			return err
+		}
+		return d.Ack(false)
+	})
+}
+
+func (r *RabbitMQ) StartResponder(topic string) (chan *BusRequest, error) {
+	c := &RabbitMQConsumer{
+		topic:    topic,
+		requests: make(chan *BusRequest),
+		done:     make(chan struct{}),
+	}
+	if err := r.startConsumer(c); err != nil {
+		return nil, err
+	}
+	return c.requests, nil
+}
+
+func (r *RabbitMQ) StopResponder(responder chan *BusRequest) error {
+	r.lock.Lock()
+	var found *RabbitMQConsumer
+	for c := range r.consumers {
+		if c.requests != nil && c.requests == responder {
+			found = c
+		}
+	}
+	r.lock.Unlock()
+	if found == nil {
+		return errors.New("Not a responder of this bus.")
+	}
+	return r.stopConsumer(found)
 }
@@ -0,0 +1,22 @@
+package ari
+
+import "testing"
+
+func TestRabbitMQProducerClosedMessages(t *testing.T) {
+	r := &RabbitMQ{producers: make(map[chan []byte]*RabbitMQProducer)}
+	p := &RabbitMQProducer{
+		topic:       "x",
+		messages:    make(chan []byte),
+		errors:      make(chan error, 16),
+		reconnected: make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	go r.produce(p)
+	close(p.Messages())
+	if err := p.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, ok := <-p.Errors(); ok {
+		t.Error("Errors not closed")
+	}
+}
@@ -0,0 +1,430 @@
+package ari
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisConfig is the configuration of the Redis message bus.
+// The topics of application instances are Pub/Sub channels: their messages
+// are delivered to every consumer, and dropped when there is none. The other
+// topics, such as those of applications, are streams. Consumers sharing a
+// group read them through a consumer group and take turns receiving the
+// messages, like the consumers of a NATS queue group; a message a member read
+// but did not hand over, e.g. because it crashed, is claimed by another
+// member once idle for ClaimIdle. Consumers without a group each receive all
+// the messages published while they run.
+type RedisConfig struct {
+	Addr      string   `json:"addr"`
+	Password  string   `json:"password"`
+	DB        int      `json:"db"`
+	Group     string   `json:"group"`      // consumer group of the stream consumers, if any
+	MaxLen    int64    `json:"max_len"`    // approximate length streams are trimmed to; untrimmed if 0
+	ClaimIdle Duration `json:"claim_idle"` // how long a message stays unacknowledged before another member of the group claims it
+}
+
+// Redis is a MessageBus using Redis Streams and Pub/Sub. Requests are
+// published on Pub/Sub with a reply channel of their own.
+type Redis struct {
+	config     RedisConfig
+	client     *redis.Client
+	lock       sync.Mutex
+	consumers  map[chan []byte]*redisConsumer
+	responders map[chan *BusRequest]*redisConsumer
+}
+
+// redisConsumer is the subscription or stream reader feeding the channel of a
+// consumer or responder.
+type redisConsumer struct {
+	pubsub   *redis.PubSub // nil for stream consumers
+	presence *redis.PubSub // subscription telling TopicExists a stream is read
+	done     chan struct{}
+}
+
+// redisRequest is the envelope of a request.
+type redisRequest struct {
+	ReplyTo string `json:"reply_to"`
+	Body    []byte `json:"body"`
+}
+
+func (r *Redis) InitBus(config interface{}) error {
+	if err := decodeConfig(config, &r.config); err != nil {
+		return err
+	}
+	if r.config.ClaimIdle <= 0 {
+		r.config.ClaimIdle = Duration(30 * time.Second)
+	}
+	r.consumers = make(map[chan []byte]*redisConsumer)
+	r.responders = make(map[chan *BusRequest]*redisConsumer)
+	r.client = redis.NewClient(&redis.Options{
+		Addr:     r.config.Addr,
+		Password: r.config.Password,
+		DB:       r.config.DB,
+	})
+	if err := r.client.Ping().Err(); err != nil {
+		r.client.Close()
+		return err
+	}
+	return nil
+}
+
+// isChannel reports whether a topic is a Pub/Sub channel rather than a stream.
+func isChannel(topic string) bool {
+	_, _, ok := splitInstanceTopic(topic)
+	return ok
+}
+
+// presenceChannel returns the Pub/Sub channel the consumers of a stream
+// subscribe to while reading it. Unlike the members of consumer groups, the
+// subscriptions go away with the connections of consumers which crashed.
+func presenceChannel(stream string) string {
+	return "presence_" + stream
+}
+
+func (r *Redis) StartProducer(topic string) (chan []byte, error) {
+	c := make(chan []byte)
+	go func(topic string, messages chan []byte) {
+		for message := range messages {
+			var err error
+			if isChannel(topic) {
+				err = r.client.Publish(topic, message).Err()
+			} else {
+				err = r.client.XAdd(&redis.XAddArgs{
+					Stream:       topic,
+					MaxLenApprox: r.config.MaxLen,
+					Values:       map[string]interface{}{"message": message},
+				}).Err()
+			}
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}(topic, c)
+	return c, nil
+}
+
+func (r *Redis) StartConsumer(topic string) (chan []byte, error) {
+	c := make(chan []byte)
+	forward := func(message []byte, done chan struct{}) bool {
+		select {
+		case c <- message:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	var consumer *redisConsumer
+	var err error
+	switch {
+	case isChannel(topic):
+		consumer, err = r.subscribe(topic, forward)
+	case len(r.config.Group) > 0:
+		consumer, err = r.readGroup(topic, forward)
+	default:
+		consumer, err = r.readStream(topic, forward)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	r.consumers[c] = consumer
+	r.lock.Unlock()
+	return c, nil
+}
+
+// subscribe subscribes to a Pub/Sub channel, and hands its messages to the
+// handler until it returns false.
+func (r *Redis) subscribe(channel string, handler func(message []byte, done chan struct{}) bool) (*redisConsumer, error) {
+	pubsub := r.client.Subscribe(channel)
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	c := &redisConsumer{pubsub: pubsub, done: make(chan struct{})}
+	go func(messages <-chan *redis.Message) {
+		for m := range messages {
+			if !handler([]byte(m.Payload), c.done) {
+				return
+			}
+		}
+	}(pubsub.Channel())
+	return c, nil
+}
+
+// present subscribes to the presence channel of a stream for a consumer.
+func (r *Redis) present(stream string) (*redisConsumer, error) {
+	presence := r.client.Subscribe(presenceChannel(stream))
+	if _, err := presence.Receive(); err != nil {
+		presence.Close()
+		return nil, err
+	}
+	return &redisConsumer{presence: presence, done: make(chan struct{})}, nil
+}
+
+// readStream hands the messages added to a stream from now on to the handler,
+// until it returns false.
+func (r *Redis) readStream(stream string, handler func(message []byte, done chan struct{}) bool) (*redisConsumer, error) {
+	last := "0-0"
+	latest, err := r.client.XRevRangeN(stream, "+", "-", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) > 0 {
+		last = latest[0].ID
+	}
+	c, err := r.present(stream)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			streams, err := r.client.XRead(&redis.XReadArgs{
+				Streams: []string{stream, last},
+				Count:   10,
+				Block:   time.Second,
+			}).Result()
+			if err != nil {
+				if err != redis.Nil {
+					fmt.Println(err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			for _, s := range streams {
+				for _, m := range s.Messages {
+					last = m.ID
+					message, _ := m.Values["message"].(string)
+					if !handler([]byte(message), c.done) {
+						return
+					}
+				}
+			}
+		}
+	}()
+	return c, nil
+}
+
+// readGroup joins the consumer group of a stream and hands the new messages
+// to the handler, acknowledging them, until it returns false. The messages
+// other members of the group left unacknowledged for ClaimIdle are claimed
+// and handed over as well.
+func (r *Redis) readGroup(stream string, handler func(message []byte, done chan struct{}) bool) (*redisConsumer, error) {
+	group := r.config.Group
+	err := r.client.XGroupCreateMkStream(stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+	c, err := r.present(stream)
+	if err != nil {
+		return nil, err
+	}
+	name := UUID()
+	deliver := func(messages []redis.XMessage) bool {
+		for _, m := range messages {
+			message, _ := m.Values["message"].(string)
+			if !handler([]byte(message), c.done) {
+				return false
+			}
+			r.client.XAck(stream, group, m.ID)
+		}
+		return true
+	}
+	go func() {
+		defer r.leaveGroup(stream, group, name)
+		var claimed time.Time
+		for {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			if time.Since(claimed) >= time.Second {
+				claimed = time.Now()
+				if !deliver(r.claim(stream, group, name)) {
+					return
+				}
+			}
+			streams, err := r.client.XReadGroup(&redis.XReadGroupArgs{
+				Group:    group,
+				Consumer: name,
+				Streams:  []string{stream, ">"},
+				Count:    10,
+				Block:    time.Second,
+			}).Result()
+			if err != nil {
+				if err != redis.Nil {
+					fmt.Println(err)
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			for _, s := range streams {
+				if !deliver(s.Messages) {
+					return
+				}
+			}
+		}
+	}()
+	return c, nil
+}
+
+// claim claims for a member of a consumer group the messages of the stream
+// left unacknowledged for ClaimIdle by the other members.
+func (r *Redis) claim(stream string, group string, name string) []redis.XMessage {
+	idle := time.Duration(r.config.ClaimIdle)
+	pending, err := r.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Result()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	var ids []string
+	for _, p := range pending {
+		if p.Idle >= idle {
+			ids = append(ids, p.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	messages, err := r.client.XClaim(&redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: name,
+		MinIdle:  idle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	return messages
+}
+
+// leaveGroup removes a member which stopped from a consumer group, unless it
+// left messages unacknowledged, which the other members will claim.
+func (r *Redis) leaveGroup(stream string, group string, name string) {
+	pending, err := r.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream:   stream,
+		Group:    group,
+		Start:    "-",
+		End:      "+",
+		Count:    1,
+		Consumer: name,
+	}).Result()
+	if err == nil && len(pending) == 0 {
+		r.client.XGroupDelConsumer(stream, group, name)
+	}
+}
+
+// stop ends the subscription, or the reading of the stream.
+func (c *redisConsumer) stop() error {
+	close(c.done)
+	if c.pubsub != nil {
+		return c.pubsub.Close()
+	}
+	return c.presence.Close()
+}
+
+func (r *Redis) StopConsumer(consumer chan []byte) error {
+	r.lock.Lock()
+	c, ok := r.consumers[consumer]
+	delete(r.consumers, consumer)
+	r.lock.Unlock()
+	if !ok {
+		return errors.New("Not a consumer of this bus.")
+	}
+	return c.stop()
+}
+
+// TopicExists reports whether the Pub/Sub channel of the topic has a
+// subscriber, or its stream a consumer.
+func (r *Redis) TopicExists(topic string) bool {
+	channel := topic
+	if !isChannel(topic) {
+		channel = presenceChannel(topic)
+	}
+	subscribers, err := r.client.PubSubNumSub(channel).Result()
+	return err == nil && subscribers[channel] > 0
+}
+
+func (r *Redis) Request(ctx context.Context, topic string, request []byte) ([]byte, error) {
+	replyTo := "replies_" + UUID()
+	pubsub := r.client.Subscribe(replyTo)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(); err != nil {
+		return nil, err
+	}
+	envelope, err := json.Marshal(redisRequest{ReplyTo: replyTo, Body: request})
+	if err != nil {
+		return nil, err
+	}
+	receivers, err := r.client.Publish(topic, envelope).Result()
+	if err != nil {
+		return nil, err
+	}
+	if receivers == 0 {
+		return nil, errors.New("No responder for topic: " + topic)
+	}
+	select {
+	case m := <-pubsub.Channel():
+		return []byte(m.Payload), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Redis) StartResponder(topic string) (chan *BusRequest, error) {
+	c := make(chan *BusRequest)
+	responder, err := r.subscribe(topic, func(message []byte, done chan struct{}) bool {
+		var envelope redisRequest
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			fmt.Println(err)
+			return true
+		}
+		request := NewBusRequest(envelope.Body, func(response []byte) error {
+			return r.client.Publish(envelope.ReplyTo, response).Err()
+		})
+		select {
+		case c <- request:
+			return true
+		case <-done:
+			return false
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	r.responders[c] = responder
+	r.lock.Unlock()
+	return c, nil
+}
+
+func (r *Redis) StopResponder(responder chan *BusRequest) error {
+	r.lock.Lock()
+	c, ok := r.responders[responder]
+	delete(r.responders, responder)
+	r.lock.Unlock()
+	if !ok {
+		return errors.New("Not a responder of this bus.")
+	}
+	return c.stop()
+}